@@ -0,0 +1,256 @@
+// Command benchreport compares two outputs of go test -bench -benchmem and
+// prints a Markdown table of the changes, e.g.
+//
+//	go test -run '^$' -bench . -benchmem -count 10 ./httpmux > new.txt
+//	git stash && go test -run '^$' -bench . -benchmem -count 10 ./httpmux > old.txt
+//	go run ./cmd/benchreport -threshold 10 old.txt new.txt
+//
+// The median of the runs of a benchmark is compared, so -count should be more
+// than one. It exits with status 1 when a benchmark is slower by more than the
+// threshold or allocates more than before, so it can fail a CI job.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Result is the median of the runs of a benchmark.
+type Result struct {
+	NsPerOp     float64
+	BytesPerOp  float64
+	AllocsPerOp float64
+}
+
+// gomaxprocsSuffix is the -N suffix that go test adds to the benchmark names.
+var gomaxprocsSuffix = regexp.MustCompile(`-\d+$`)
+
+// Parse reads the benchmark lines of a go test output, the other lines are
+// ignored.
+func Parse(r io.Reader) (map[string]Result, error) {
+	runs := make(map[string][]Result)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+
+		var result Result
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("benchmark %s: %w", fields[0], err)
+			}
+
+			switch fields[i+1] {
+			case "ns/op":
+				result.NsPerOp = value
+			case "B/op":
+				result.BytesPerOp = value
+			case "allocs/op":
+				result.AllocsPerOp = value
+			}
+		}
+
+		name := gomaxprocsSuffix.ReplaceAllString(fields[0], "")
+		runs[name] = append(runs[name], result)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]Result, len(runs))
+	for name, rs := range runs {
+		results[name] = Result{
+			NsPerOp:     median(rs, func(r Result) float64 { return r.NsPerOp }),
+			BytesPerOp:  median(rs, func(r Result) float64 { return r.BytesPerOp }),
+			AllocsPerOp: median(rs, func(r Result) float64 { return r.AllocsPerOp }),
+		}
+	}
+
+	return results, nil
+}
+
+func median(rs []Result, value func(Result) float64) float64 {
+	values := make([]float64, len(rs))
+	for i, r := range rs {
+		values[i] = value(r)
+	}
+
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+
+	return values[mid]
+}
+
+// Comparison is the change of a benchmark, a benchmark that is only in one of
+// the outputs has no change.
+type Comparison struct {
+	Name     string
+	Old, New *Result
+
+	// Regressed reports whether the benchmark is slower than the threshold or
+	// allocates more.
+	Regressed bool
+}
+
+// Compare compares the benchmarks in both outputs, sorted by the name. The
+// threshold is the percentage of the ns/op increase that counts as a
+// regression.
+func Compare(base, head map[string]Result, threshold float64) []Comparison {
+	names := make(map[string]struct{})
+	for name := range base {
+		names[name] = struct{}{}
+	}
+
+	for name := range head {
+		names[name] = struct{}{}
+	}
+
+	comparisons := make([]Comparison, 0, len(names))
+	for name := range names {
+		c := Comparison{Name: name}
+		if r, ok := base[name]; ok {
+			c.Old = &r
+		}
+
+		if r, ok := head[name]; ok {
+			c.New = &r
+		}
+
+		if c.Old != nil && c.New != nil {
+			c.Regressed = delta(c.Old.NsPerOp, c.New.NsPerOp) > threshold || c.New.AllocsPerOp > c.Old.AllocsPerOp
+		}
+
+		comparisons = append(comparisons, c)
+	}
+
+	sort.Slice(comparisons, func(i, j int) bool {
+		return comparisons[i].Name < comparisons[j].Name
+	})
+
+	return comparisons
+}
+
+// delta returns the change from before to after in percent.
+func delta(before, after float64) float64 {
+	if before == 0 {
+		if after == 0 {
+			return 0
+		}
+
+		return 100
+	}
+
+	return (after - before) / before * 100
+}
+
+// WriteReport writes the comparisons as a Markdown table.
+func WriteReport(w io.Writer, comparisons []Comparison) {
+	_, _ = fmt.Fprintln(w, "| benchmark | old ns/op | new ns/op | delta | old allocs/op | new allocs/op | delta | |")
+	_, _ = fmt.Fprintln(w, "|---|---:|---:|---:|---:|---:|---:|---|")
+	for _, c := range comparisons {
+		cell := func(r *Result, value func(Result) float64) string {
+			if r == nil {
+				return "-"
+			}
+
+			return strconv.FormatFloat(value(*r), 'f', -1, 64)
+		}
+
+		deltaCell := func(value func(Result) float64) string {
+			if c.Old == nil || c.New == nil {
+				return "-"
+			}
+
+			return fmt.Sprintf("%+.2f%%", delta(value(*c.Old), value(*c.New)))
+		}
+
+		ns := func(r Result) float64 { return r.NsPerOp }
+		allocs := func(r Result) float64 { return r.AllocsPerOp }
+
+		status := ""
+		switch {
+		case c.Regressed:
+			status = "regression"
+		case c.Old == nil:
+			status = "new"
+		case c.New == nil:
+			status = "removed"
+		}
+
+		_, _ = fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %s | %s |\n",
+			c.Name,
+			cell(c.Old, ns), cell(c.New, ns), deltaCell(ns),
+			cell(c.Old, allocs), cell(c.New, allocs), deltaCell(allocs),
+			status,
+		)
+	}
+}
+
+func main() {
+	threshold := flag.Float64("threshold", 10, "the ns/op increase in percent that fails the comparison")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "usage: benchreport [-threshold percent] old.txt new.txt")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	head, err := parseFile(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	comparisons := Compare(base, head, *threshold)
+	WriteReport(os.Stdout, comparisons)
+
+	regressed := false
+	for _, c := range comparisons {
+		if c.Regressed {
+			fmt.Fprintf(os.Stderr, "%s regressed\n", c.Name)
+			regressed = true
+		}
+	}
+
+	if regressed {
+		os.Exit(1)
+	}
+}
+
+func parseFile(name string) (map[string]Result, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = f.Close() }()
+	return Parse(f)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOld = `goos: linux
+BenchmarkTrie_Get/GitHub/Static-8   	10000000	       100 ns/op	      32 B/op	       1 allocs/op
+BenchmarkTrie_Get/GitHub/Static-8   	10000000	       120 ns/op	      32 B/op	       1 allocs/op
+BenchmarkTrie_Get/GitHub/Static-8   	10000000	       110 ns/op	      32 B/op	       1 allocs/op
+BenchmarkTrie_Get/GitHub/Param-8    	 5000000	       200 ns/op	     160 B/op	       3 allocs/op
+BenchmarkTrie_Get/GitHub/Miss-8     	 5000000	       300 ns/op	     176 B/op	       4 allocs/op
+PASS
+`
+
+const testNew = `BenchmarkTrie_Get/GitHub/Static-8   	10000000	       115 ns/op	      32 B/op	       1 allocs/op
+BenchmarkTrie_Get/GitHub/Param-8    	 5000000	       200 ns/op	     192 B/op	       4 allocs/op
+BenchmarkTrie_Get/GitHub/All-8      	   10000	     70000 ns/op	   32080 B/op	     542 allocs/op
+`
+
+func TestParse(t *testing.T) {
+	results, err := Parse(strings.NewReader(testOld))
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	static, ok := results["BenchmarkTrie_Get/GitHub/Static"]
+	if !ok || len(results) != 3 {
+		t.Fatalf("expected 3 benchmarks without the GOMAXPROCS suffix; got %v", results)
+	}
+
+	if static.NsPerOp != 110 || static.BytesPerOp != 32 || static.AllocsPerOp != 1 {
+		t.Errorf("expected the median 110 ns/op 32 B/op 1 allocs/op; got %+v", static)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base, _ := Parse(strings.NewReader(testOld))
+	head, _ := Parse(strings.NewReader(testNew))
+
+	comparisons := Compare(base, head, 10)
+	regressed := make(map[string]bool)
+	for _, c := range comparisons {
+		regressed[c.Name] = c.Regressed
+	}
+
+	expected := map[string]bool{
+		// +4.5% is under the threshold.
+		"BenchmarkTrie_Get/GitHub/Static": false,
+		// an extra allocation is always a regression.
+		"BenchmarkTrie_Get/GitHub/Param": true,
+		"BenchmarkTrie_Get/GitHub/Miss":  false,
+		"BenchmarkTrie_Get/GitHub/All":   false,
+	}
+
+	for name, exp := range expected {
+		if got, ok := regressed[name]; !ok || got != exp {
+			t.Errorf("%s: expected regressed %v; got %v", name, exp, got)
+		}
+	}
+
+	var report strings.Builder
+	WriteReport(&report, comparisons)
+
+	for _, line := range []string{
+		"| BenchmarkTrie_Get/GitHub/All | - | 70000 | - | - | 542 | - | new |",
+		"| BenchmarkTrie_Get/GitHub/Miss | 300 | - | - | 4 | - | - | removed |",
+		"| BenchmarkTrie_Get/GitHub/Param | 200 | 200 | +0.00% | 3 | 4 | +33.33% | regression |",
+		"| BenchmarkTrie_Get/GitHub/Static | 110 | 115 | +4.55% | 1 | 1 | +0.00% |  |",
+	} {
+		if !strings.Contains(report.String(), line) {
+			t.Errorf("expected the report to contain %q; got\n%s", line, report.String())
+		}
+	}
+}
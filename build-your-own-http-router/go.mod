@@ -1,3 +1,13 @@
 module github.com/josestg/build-your-own-http-router
 
-go 1.18
+go 1.24.0
+
+require (
+	github.com/josestg/implement-your-own-jwt v0.0.0
+	golang.org/x/net v0.47.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.31.0 // indirect
+
+replace github.com/josestg/implement-your-own-jwt => ../implement-your-own-jwt
@@ -0,0 +1,185 @@
+package httpmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// The benchmarks measure the lookups of the well-known route sets, compare the
+// runs with cmd/benchreport, e.g.
+//
+//	go test -run '^$' -bench . -benchmem -count 10 ./httpmux > new.txt
+//	go run ./cmd/benchreport old.txt new.txt
+
+var benchVarsRegex = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// benchPath returns a request path that matches the route path, every var is
+// replaced by its name.
+func benchPath(path string) string {
+	return benchVarsRegex.ReplaceAllString(path, "$1")
+}
+
+type benchCase struct {
+	name   string
+	method string
+	path   string
+}
+
+type benchSet struct {
+	name   string
+	routes []benchRoute
+	cases  []benchCase
+}
+
+var benchSets = []benchSet{
+	{
+		name:   "GitHub",
+		routes: githubAPI,
+		cases: []benchCase{
+			{name: "Static", method: http.MethodGet, path: "/user/repos"},
+			{name: "Param", method: http.MethodGet, path: "/repos/julienschmidt/httprouter/stargazers"},
+			{name: "Miss", method: http.MethodGet, path: "/repos/julienschmidt/httprouter/unknown"},
+		},
+	},
+	{
+		name:   "Parse",
+		routes: parseAPI,
+		cases: []benchCase{
+			{name: "Static", method: http.MethodGet, path: "/1/users"},
+			{name: "Param", method: http.MethodGet, path: "/1/classes/go/123456789"},
+			{name: "Miss", method: http.MethodGet, path: "/1/unknown/go"},
+		},
+	},
+	{
+		name:   "Static",
+		routes: staticFiles,
+		cases: []benchCase{
+			{name: "Static", method: http.MethodGet, path: "/gopher/pencil/gopherswrench.jpg"},
+			{name: "Miss", method: http.MethodGet, path: "/gopher/pencil/unknown.jpg"},
+		},
+	},
+}
+
+func newBenchTrie(tb testing.TB, routes []benchRoute) *Trie {
+	trie := NewTrie()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, route := range routes {
+		if err := trie.Insert(route.path, route.method, handler); err != nil {
+			tb.Fatalf("insert %s %s: %v", route.method, route.path, err)
+		}
+	}
+
+	return trie
+}
+
+func newBenchRouter(routes []benchRoute) *Router {
+	router := NewRouter()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, route := range routes {
+		router.Handle(route.method, route.path, handler)
+	}
+
+	return router
+}
+
+// benchResponseWriter discards the response without allocating, so the
+// benchmarks measure the router only.
+type benchResponseWriter struct {
+	header http.Header
+}
+
+func (w *benchResponseWriter) Header() http.Header         { return w.header }
+func (w *benchResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *benchResponseWriter) WriteHeader(int)             {}
+
+func TestBenchSets(t *testing.T) {
+	for _, set := range benchSets {
+		trie := newBenchTrie(t, set.routes)
+		for _, route := range set.routes {
+			if _, _, err := trie.Get(benchPath(route.path), route.method); err != nil {
+				t.Errorf("%s: expected %s %s to match; got %v", set.name, route.method, route.path, err)
+			}
+		}
+
+		router := newBenchRouter(set.routes)
+		for _, c := range set.cases {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+
+			expected := http.StatusOK
+			if c.name == "Miss" {
+				expected = http.StatusNotFound
+			}
+
+			if rec.Code != expected {
+				t.Errorf("%s/%s: expected %d; got %d", set.name, c.name, expected, rec.Code)
+			}
+		}
+	}
+}
+
+func BenchmarkTrie_Get(b *testing.B) {
+	for _, set := range benchSets {
+		trie := newBenchTrie(b, set.routes)
+		for _, c := range set.cases {
+			b.Run(set.name+"/"+c.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, _, _ = trie.Get(c.path, c.method)
+				}
+			})
+		}
+
+		paths := make([]string, len(set.routes))
+		for i, route := range set.routes {
+			paths[i] = benchPath(route.path)
+		}
+
+		// All looks up every route once per iteration.
+		b.Run(set.name+"/All", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j, route := range set.routes {
+					_, _, _ = trie.Get(paths[j], route.method)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRouter_ServeHTTP(b *testing.B) {
+	for _, set := range benchSets {
+		router := newBenchRouter(set.routes)
+		for _, c := range set.cases {
+			b.Run(set.name+"/"+c.name, func(b *testing.B) {
+				req := httptest.NewRequest(c.method, c.path, nil)
+				w := &benchResponseWriter{header: make(http.Header)}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					router.ServeHTTP(w, req)
+				}
+			})
+		}
+
+		reqs := make([]*http.Request, len(set.routes))
+		for i, route := range set.routes {
+			reqs[i] = httptest.NewRequest(route.method, benchPath(route.path), nil)
+		}
+
+		b.Run(set.name+"/All", func(b *testing.B) {
+			w := &benchResponseWriter{header: make(http.Header)}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, req := range reqs {
+					router.ServeHTTP(w, req)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,646 @@
+package httpmux
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicy declares how the responses of a route are cached.
+type CachePolicy struct {
+	// TTL is how long a response is fresh, the max-age or s-maxage of the
+	// response Cache-Control takes precedence.
+	TTL time.Duration
+
+	// StaleWhileRevalidate is how long a stale response is still served
+	// while it is refreshed in the background, the stale-while-revalidate of
+	// the response Cache-Control takes precedence.
+	StaleWhileRevalidate time.Duration
+
+	// Query lists the query parameters that are part of the cache key, nil
+	// means every parameter.
+	Query []string
+}
+
+type cacheMetaKey struct{}
+
+// WithCache declares the cache policy of a route. The policy is enforced by
+// the Cache middleware.
+func WithCache(policy CachePolicy) RouteOption {
+	return WithMeta(cacheMetaKey{}, policy)
+}
+
+// CacheOptions configures the Cache.
+type CacheOptions struct {
+	// MaxBytes is the total size of the cached responses, the least recently
+	// used responses are evicted when it is exceeded. Default is 64 MiB.
+	MaxBytes int64
+
+	// MaxEntryBytes is the size of the biggest cached response, default is
+	// 1 MiB. A response body over the limit stops being recorded, it is
+	// streamed to the client and not cached.
+	MaxEntryBytes int64
+}
+
+// Cache is an in-memory response cache for the routes declared using
+// WithCache. The responses are keyed by the route pattern, the vars, the
+// normalized query and the request headers named by the response Vary.
+type Cache struct {
+	opts CacheOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	flights map[string]*cacheFlight
+	varies  map[string]*cacheVary
+	size    int64
+}
+
+// cacheVary is the Vary of the responses stored for a primary key, i.e. the
+// key without the request headers.
+type cacheVary struct {
+	headers []string
+	entries int
+}
+
+type cacheEntry struct {
+	key     string
+	primary string
+	vary    []string
+	name    string
+	pattern string
+	vars    Vars
+
+	status int
+	header http.Header
+	body   []byte
+	size   int64
+
+	storedAt   time.Time
+	freshUntil time.Time
+	staleUntil time.Time
+}
+
+// cacheFlight is a request in progress, the concurrent requests of the same
+// key wait for its entry.
+type cacheFlight struct {
+	done  chan struct{}
+	entry *cacheEntry
+}
+
+func NewCache(opts CacheOptions) *Cache {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 64 << 20
+	}
+
+	if opts.MaxEntryBytes <= 0 {
+		opts.MaxEntryBytes = 1 << 20
+	}
+
+	return &Cache{
+		opts:    opts,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		flights: make(map[string]*cacheFlight),
+		varies:  make(map[string]*cacheVary),
+	}
+}
+
+// Middleware creates a middleware that serves the GET and HEAD requests from
+// the cache. The responses are buffered up to the MaxEntryBytes, and only the
+// responses that are cacheable by a shared cache are stored: the requests
+// with Authorization and the responses with Set-Cookie, Vary: * or with the
+// private, no-cache or no-store directives are not cached. The concurrent misses of the same key
+// are coalesced into a single handler call. The Cache-Status header tells
+// how the response is served.
+func (c *Cache) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := GetRoute(r.Context())
+			if route == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Authorization") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			policy, ok := route.Meta(cacheMetaKey{}).(CachePolicy)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			vars := GetVars(r.Context())
+			primary := cacheKey(route, vars, r.URL.Query(), policy.Query)
+			key := c.variantKey(primary, r.Header)
+
+			if entry := c.get(key); entry != nil {
+				now := c.now()
+				if now.Before(entry.freshUntil) {
+					c.serve(w, r, entry, now)
+					return
+				}
+
+				if now.Before(entry.staleUntil) {
+					c.serve(w, r, entry, now)
+					c.revalidate(next, r, primary, key, route, vars, policy)
+					return
+				}
+			}
+
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c.fetch(w, r, next, primary, key, route, vars, policy)
+		})
+	}
+}
+
+// Invalidate removes the cached responses of the route, the route is the
+// name given by WithName or the pattern. Only the responses that have every
+// of the vars are removed, no vars means every response of the route. It
+// returns the number of the removed responses.
+func (c *Cache) Invalidate(route string, vars Vars) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for _, elem := range c.entries {
+		entry := elem.Value.(*cacheEntry)
+		if entry.name != route && entry.pattern != route {
+			continue
+		}
+
+		matched := true
+		for _, v := range vars {
+			if entry.vars.ByName(v.Name) != v.Value {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			c.remove(elem)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Len returns the number of the cached responses.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Size returns the size of the cached responses in bytes.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// variantKey returns the key of the request, it is the primary key followed
+// by the request headers named by the Vary of the stored responses.
+func (c *Cache) variantKey(primary string, header http.Header) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vary, ok := c.varies[primary]
+	if !ok {
+		return primary
+	}
+
+	return primary + varySuffix(vary.headers, header)
+}
+
+func (c *Cache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry)
+}
+
+// fetch calls the handler, the concurrent requests of the same key wait for
+// the first one. The waiting requests call the handler themselves if the
+// response is not cacheable or varies by a header that they send
+// differently.
+func (c *Cache) fetch(w http.ResponseWriter, r *http.Request, next http.Handler, primary string, key string, route *Route, vars Vars, policy CachePolicy) {
+	c.mu.Lock()
+	if flight, ok := c.flights[key]; ok {
+		c.mu.Unlock()
+
+		select {
+		case <-flight.done:
+		case <-r.Context().Done():
+			return
+		}
+
+		if entry := flight.entry; entry != nil && entry.key == primary+varySuffix(entry.vary, r.Header) {
+			w.Header().Set("Cache-Status", "httpmux; fwd=miss; collapsed")
+			writeCacheEntry(w, r, flight.entry)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	flight := &cacheFlight{done: make(chan struct{})}
+	c.flights[key] = flight
+	c.mu.Unlock()
+
+	defer c.land(key, flight)
+
+	cw := c.newCacheWriter(w)
+	next.ServeHTTP(cw, r)
+	if cw.streaming {
+		return
+	}
+
+	flight.entry = c.store(primary, r.Header, route, vars, policy, &cw.rec)
+
+	h := w.Header()
+	for k, v := range cw.rec.header {
+		h[k] = v
+	}
+
+	if flight.entry != nil {
+		h.Set("Cache-Status", "httpmux; fwd=miss; stored")
+	} else {
+		h.Set("Cache-Status", "httpmux; fwd=miss")
+	}
+
+	w.WriteHeader(cw.rec.status)
+	_, _ = w.Write(cw.rec.buf.Bytes())
+}
+
+// revalidate refreshes the stale entry in the background, at most one
+// refresh per key is in progress.
+func (c *Cache) revalidate(next http.Handler, r *http.Request, primary string, key string, route *Route, vars Vars, policy CachePolicy) {
+	c.mu.Lock()
+	if _, ok := c.flights[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+
+	flight := &cacheFlight{done: make(chan struct{})}
+	c.flights[key] = flight
+	c.mu.Unlock()
+
+	req := r.Clone(context.WithoutCancel(r.Context()))
+	req.Method = http.MethodGet
+	req.Body = http.NoBody
+
+	go func() {
+		defer c.land(key, flight)
+
+		cw := c.newCacheWriter(nil)
+		next.ServeHTTP(cw, req)
+		if !cw.streaming {
+			flight.entry = c.store(primary, req.Header, route, vars, policy, &cw.rec)
+		}
+	}()
+}
+
+// cacheWriter records the response until the body exceeds the limit, then
+// it stops recording and streams the response to w. A nil w discards the
+// rest of the response, e.g. for the background revalidation.
+type cacheWriter struct {
+	w         http.ResponseWriter
+	rec       recorderWriter
+	limit     int64
+	streaming bool
+}
+
+func (c *Cache) newCacheWriter(w http.ResponseWriter) *cacheWriter {
+	limit := c.opts.MaxEntryBytes
+	if c.opts.MaxBytes < limit {
+		limit = c.opts.MaxBytes
+	}
+
+	return &cacheWriter{
+		w:     w,
+		rec:   recorderWriter{header: make(http.Header), status: http.StatusOK},
+		limit: limit,
+	}
+}
+
+func (cw *cacheWriter) Header() http.Header {
+	return cw.rec.header
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	cw.rec.WriteHeader(code)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.streaming && int64(cw.rec.buf.Len()+len(b)) <= cw.limit {
+		return cw.rec.Write(b)
+	}
+
+	if !cw.streaming {
+		cw.stream()
+	}
+
+	if cw.w == nil {
+		return len(b), nil
+	}
+
+	return cw.w.Write(b)
+}
+
+// stream writes the recorded response to w, the later writes go to w
+// directly.
+func (cw *cacheWriter) stream() {
+	cw.streaming = true
+	if cw.w == nil {
+		return
+	}
+
+	h := cw.w.Header()
+	for k, v := range cw.rec.header {
+		h[k] = v
+	}
+
+	h.Set("Cache-Status", "httpmux; fwd=miss")
+	cw.w.WriteHeader(cw.rec.status)
+	_, _ = cw.w.Write(cw.rec.buf.Bytes())
+	cw.rec.buf = bytes.Buffer{}
+}
+
+// land ends the flight and wakes up the waiting requests.
+func (c *Cache) land(key string, flight *cacheFlight) {
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(flight.done)
+}
+
+// store adds the response to the cache if it is cacheable, and returns the
+// entry or nil. The entry is keyed by the request headers named by the Vary.
+func (c *Cache) store(primary string, reqHeader http.Header, route *Route, vars Vars, policy CachePolicy, rec *recorderWriter) *cacheEntry {
+	if !cacheableStatus(rec.status) || rec.header.Get("Set-Cookie") != "" {
+		return nil
+	}
+
+	vary, ok := varyHeaders(rec.header)
+	if !ok {
+		return nil
+	}
+
+	ttl, swr := policy.TTL, policy.StaleWhileRevalidate
+	directives := parseCacheControl(rec.header.Get("Cache-Control"))
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[name]; ok {
+			return nil
+		}
+	}
+
+	if d, ok := directiveSeconds(directives, "max-age"); ok {
+		ttl = d
+	}
+
+	if d, ok := directiveSeconds(directives, "s-maxage"); ok {
+		ttl = d
+	}
+
+	if d, ok := directiveSeconds(directives, "stale-while-revalidate"); ok {
+		swr = d
+	}
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	key := primary + varySuffix(vary, reqHeader)
+	body := append([]byte(nil), rec.buf.Bytes()...)
+	size := int64(len(key) + len(body))
+	for k, values := range rec.header {
+		for _, v := range values {
+			size += int64(len(k) + len(v))
+		}
+	}
+
+	if size > c.opts.MaxEntryBytes || size > c.opts.MaxBytes {
+		return nil
+	}
+
+	now := c.now()
+	entry := &cacheEntry{
+		key:        key,
+		primary:    primary,
+		vary:       vary,
+		name:       route.Name,
+		pattern:    route.Pattern,
+		vars:       append(Vars(nil), vars...),
+		status:     rec.status,
+		header:     rec.header.Clone(),
+		body:       body,
+		size:       size,
+		storedAt:   now,
+		freshUntil: now.Add(ttl),
+		staleUntil: now.Add(ttl + swr),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+	if v, ok := c.varies[primary]; ok {
+		v.headers = vary
+		v.entries++
+	} else {
+		c.varies[primary] = &cacheVary{headers: vary, entries: 1}
+	}
+
+	for c.size > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+
+	return entry
+}
+
+// remove deletes the entry, the c.mu must be held.
+func (c *Cache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+
+	if v := c.varies[entry.primary]; v != nil {
+		if v.entries--; v.entries == 0 {
+			delete(c.varies, entry.primary)
+		}
+	}
+}
+
+// serve writes the entry, the stale entry is reported as fwd=stale because
+// it is being refreshed.
+func (c *Cache) serve(w http.ResponseWriter, r *http.Request, entry *cacheEntry, now time.Time) {
+	age := now.Sub(entry.storedAt).Truncate(time.Second)
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+
+	if now.Before(entry.freshUntil) {
+		ttl := entry.freshUntil.Sub(now).Truncate(time.Second)
+		w.Header().Set("Cache-Status", "httpmux; hit; ttl="+strconv.Itoa(int(ttl.Seconds())))
+	} else {
+		w.Header().Set("Cache-Status", "httpmux; fwd=stale")
+	}
+
+	writeCacheEntry(w, r, entry)
+}
+
+func writeCacheEntry(w http.ResponseWriter, r *http.Request, entry *cacheEntry) {
+	h := w.Header()
+	for k, v := range entry.header {
+		h[k] = append([]string(nil), v...)
+	}
+
+	w.WriteHeader(entry.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(entry.body)
+	}
+}
+
+// cacheKey identifies the response by the route, the vars sorted by name and
+// the query sorted by key and value.
+func cacheKey(route *Route, vars Vars, query url.Values, params []string) string {
+	var sb strings.Builder
+	sb.WriteString(route.Host)
+	sb.WriteByte(' ')
+	sb.WriteString(route.Pattern)
+
+	sorted := append(Vars(nil), vars...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	for _, v := range sorted {
+		sb.WriteByte('\x00')
+		sb.WriteString(v.Name)
+		sb.WriteByte('=')
+		sb.WriteString(v.Value)
+	}
+
+	normalized := make(url.Values)
+	for name, values := range query {
+		if params != nil && !containsString(params, name) {
+			continue
+		}
+
+		values = append([]string(nil), values...)
+		sort.Strings(values)
+		normalized[name] = values
+	}
+
+	sb.WriteByte('?')
+	sb.WriteString(normalized.Encode())
+	return sb.String()
+}
+
+// varyHeaders returns the sorted canonical names listed by the Vary of the
+// response, it reports false for Vary: * because no request matches it.
+func varyHeaders(header http.Header) ([]string, bool) {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+
+			if name != "" && !containsString(names, http.CanonicalHeaderKey(name)) {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names, true
+}
+
+// varySuffix appends the values of the varied request headers to the key.
+func varySuffix(names []string, header http.Header) string {
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteByte('\x00')
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(header.Values(name), ", "))
+	}
+
+	return sb.String()
+}
+
+func cacheableStatus(status int) bool {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusNotFound,
+		http.StatusMethodNotAllowed, http.StatusGone, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseCacheControl parses the directives, the names are lower cased.
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+
+	return directives
+}
+
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	arg, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
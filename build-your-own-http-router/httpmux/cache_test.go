@@ -0,0 +1,299 @@
+package httpmux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func serveCache(router http.Handler, method string, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestCache(t *testing.T) {
+	var calls atomic.Int32
+	cache := NewCache(CacheOptions{})
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+
+	router := NewRouter()
+	router.Use(cache.Middleware())
+	router.HandleFunc(http.MethodGet, "/users/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = io.WriteString(w, GetVars(r.Context()).ByName("uid")+" "+r.URL.Query().Get("fields"))
+	}, WithName("user"), WithCache(CachePolicy{TTL: time.Minute, Query: []string{"fields", "page"}}))
+
+	router.HandleFunc(http.MethodGet, "/private", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "private, max-age=60")
+	}, WithCache(CachePolicy{TTL: time.Minute}))
+
+	router.HandleFunc(http.MethodGet, "/short", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=1")
+	}, WithCache(CachePolicy{TTL: time.Hour}))
+
+	rec := serveCache(router, http.MethodGet, "/users/1?fields=name&page=1&page=2&utm=x")
+	ExpectHeader(t, rec.Header(), "Cache-Status", "httpmux; fwd=miss; stored")
+
+	// the query order and the parameters outside of the policy don't matter.
+	rec = serveCache(router, http.MethodGet, "/users/1?page=2&fields=name&page=1")
+	ExpectHeader(t, rec.Header(), "Cache-Status", "httpmux; hit; ttl=60")
+	ExpectTrue(t, rec.Body.String() == "1 name")
+	ExpectTrue(t, calls.Load() == 1)
+
+	serveCache(router, http.MethodGet, "/users/2")
+	ExpectTrue(t, calls.Load() == 2)
+
+	now = now.Add(30 * time.Second)
+	rec = serveCache(router, http.MethodGet, "/users/2")
+	ExpectHeader(t, rec.Header(), "Age", "30")
+	ExpectHeader(t, rec.Header(), "Cache-Status", "httpmux; hit; ttl=30")
+
+	// the response Cache-Control takes precedence over the policy.
+	serveCache(router, http.MethodGet, "/private")
+	serveCache(router, http.MethodGet, "/private")
+	ExpectTrue(t, calls.Load() == 4)
+
+	serveCache(router, http.MethodGet, "/short")
+	now = now.Add(2 * time.Second)
+	serveCache(router, http.MethodGet, "/short")
+	ExpectTrue(t, calls.Load() == 6)
+
+	// the requests with credentials are not cached.
+	req := httptest.NewRequest(http.MethodGet, "/users/2", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	ExpectTrue(t, calls.Load() == 7)
+
+	// the GET patterns also serve HEAD from the cache.
+	router.HandlePatternFunc("GET /docs", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = io.WriteString(w, "docs")
+	}, WithCache(CachePolicy{TTL: time.Minute}))
+
+	serveCache(router, http.MethodGet, "/docs")
+	rec = serveCache(router, http.MethodHead, "/docs")
+	ExpectTrue(t, rec.Code == http.StatusOK && rec.Body.Len() == 0)
+	ExpectTrue(t, calls.Load() == 8)
+
+	ExpectTrue(t, cache.Invalidate("user", Vars{{Name: "uid", Value: "2"}}) == 1)
+	ExpectTrue(t, cache.Invalidate("/users/{uid}", nil) == 1)
+	ExpectTrue(t, cache.Len() == 2)
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	revalidated := make(chan struct{}, 1)
+
+	cache := NewCache(CacheOptions{})
+	var mu sync.Mutex
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	router := NewRouter()
+	router.Use(cache.Middleware())
+	router.HandleFunc(http.MethodGet, "/feed", func(w http.ResponseWriter, r *http.Request) {
+		v := version.Add(1)
+		_, _ = io.WriteString(w, strings.Repeat("v", int(v)))
+		if v > 1 {
+			revalidated <- struct{}{}
+		}
+	}, WithCache(CachePolicy{TTL: 10 * time.Second, StaleWhileRevalidate: time.Minute}))
+
+	serveCache(router, http.MethodGet, "/feed")
+
+	mu.Lock()
+	now = now.Add(20 * time.Second)
+	mu.Unlock()
+
+	rec := serveCache(router, http.MethodGet, "/feed")
+	ExpectTrue(t, rec.Body.String() == "v")
+	ExpectHeader(t, rec.Header(), "Cache-Status", "httpmux; fwd=stale")
+	ExpectHeader(t, rec.Header(), "Age", "20")
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("expected the stale response to be revalidated")
+	}
+
+	// wait until the revalidated response is stored.
+	for deadline := time.Now().Add(time.Second); ; {
+		rec = serveCache(router, http.MethodGet, "/feed")
+		if rec.Body.String() == "vv" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the revalidated response; got %q", rec.Body.String())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	now = now.Add(2 * time.Minute)
+	mu.Unlock()
+
+	rec = serveCache(router, http.MethodGet, "/feed")
+	ExpectTrue(t, rec.Body.String() == "vvv")
+	ExpectHeader(t, rec.Header(), "Cache-Status", "httpmux; fwd=miss; stored")
+}
+
+func TestCache_Vary(t *testing.T) {
+	var calls atomic.Int32
+	cache := NewCache(CacheOptions{})
+
+	router := NewRouter()
+	router.Use(cache.Middleware())
+	router.HandleFunc(http.MethodGet, "/report", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Add("Vary", "accept-encoding")
+		w.Header().Add("Vary", "Accept, Accept-Encoding")
+		_, _ = io.WriteString(w, r.Header.Get("Accept-Encoding")+" "+r.Header.Get("Accept"))
+	}, WithCache(CachePolicy{TTL: time.Minute}))
+
+	router.HandleFunc(http.MethodGet, "/any", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Vary", "*")
+	}, WithCache(CachePolicy{TTL: time.Minute}))
+
+	serve := func(target string, encoding string, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ExpectHeader(t, serve("/report", "gzip", "").Header(), "Cache-Status", "httpmux; fwd=miss; stored")
+	ExpectHeader(t, serve("/report", "", "").Header(), "Cache-Status", "httpmux; fwd=miss; stored")
+	ExpectHeader(t, serve("/report", "gzip", "text/csv").Header(), "Cache-Status", "httpmux; fwd=miss; stored")
+	ExpectTrue(t, calls.Load() == 3 && cache.Len() == 3)
+
+	for _, tt := range []struct{ encoding, accept, body string }{
+		{encoding: "gzip", body: "gzip "},
+		{body: " "},
+		{encoding: "gzip", accept: "text/csv", body: "gzip text/csv"},
+	} {
+		rec := serve("/report", tt.encoding, tt.accept)
+		ExpectTrue(t, strings.HasPrefix(rec.Header().Get("Cache-Status"), "httpmux; hit") && rec.Body.String() == tt.body)
+	}
+
+	ExpectTrue(t, calls.Load() == 3)
+
+	// no request matches Vary: *, so the response is never stored.
+	ExpectHeader(t, serve("/any", "", "").Header(), "Cache-Status", "httpmux; fwd=miss")
+	ExpectHeader(t, serve("/any", "", "").Header(), "Cache-Status", "httpmux; fwd=miss")
+	ExpectTrue(t, calls.Load() == 5)
+
+	ExpectTrue(t, cache.Invalidate("/report", nil) == 3)
+	ExpectTrue(t, cache.Len() == 0 && len(cache.varies) == 0)
+}
+
+func TestCache_Coalescing(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	cache := NewCache(CacheOptions{})
+	router := NewRouter()
+	router.Use(cache.Middleware())
+	router.HandleFunc(http.MethodGet, "/slow", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	}, WithCache(CachePolicy{TTL: time.Minute}))
+
+	const n = 10
+	var wg sync.WaitGroup
+	bodies := make(chan string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies <- serveCache(router, http.MethodGet, "/slow").Body.String()
+		}()
+	}
+
+	// the waiting requests must not call the handler.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(bodies)
+
+	ExpectTrue(t, calls.Load() == 1)
+	for body := range bodies {
+		ExpectTrue(t, body == "done")
+	}
+}
+
+func TestCache_Eviction(t *testing.T) {
+	cache := NewCache(CacheOptions{MaxBytes: 2500, MaxEntryBytes: 2000})
+	router := NewRouter()
+	router.Use(cache.Middleware())
+	router.HandleFunc(http.MethodGet, "/blobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		size := 1000
+		if GetVars(r.Context()).ByName("id") == "huge" {
+			size = 3000
+		}
+		_, _ = io.WriteString(w, strings.Repeat("x", size))
+	}, WithCache(CachePolicy{TTL: time.Minute}))
+
+	serveCache(router, http.MethodGet, "/blobs/1")
+	serveCache(router, http.MethodGet, "/blobs/2")
+	serveCache(router, http.MethodGet, "/blobs/1")
+	serveCache(router, http.MethodGet, "/blobs/3")
+
+	// the least recently used response is evicted.
+	ExpectTrue(t, cache.Len() == 2)
+	ExpectTrue(t, cache.Size() <= 2500)
+	ExpectTrue(t, strings.HasPrefix(serveCache(router, http.MethodGet, "/blobs/1").Header().Get("Cache-Status"), "httpmux; hit"))
+	ExpectHeader(t, serveCache(router, http.MethodGet, "/blobs/2").Header(), "Cache-Status", "httpmux; fwd=miss; stored")
+
+	ExpectHeader(t, serveCache(router, http.MethodGet, "/blobs/huge").Header(), "Cache-Status", "httpmux; fwd=miss")
+	ExpectTrue(t, cache.Len() == 2)
+}
+
+func TestCache_StreamsLargeResponse(t *testing.T) {
+	cache := NewCache(CacheOptions{MaxEntryBytes: 2000})
+	rec := httptest.NewRecorder()
+
+	var streamed int
+	router := NewRouter()
+	router.Use(cache.Middleware())
+	router.HandleFunc(http.MethodGet, "/blobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		for i := 0; i < 3; i++ {
+			_, _ = io.WriteString(w, strings.Repeat("x", 1000))
+		}
+
+		// the recording stops at the limit, the rest is not buffered.
+		streamed = rec.Body.Len()
+	}, WithCache(CachePolicy{TTL: time.Minute}))
+
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/blobs", nil))
+	ExpectTrue(t, streamed == 3000)
+	ExpectTrue(t, rec.Body.Len() == 3000)
+	ExpectHeader(t, rec.Header(), "Content-Type", "application/octet-stream")
+	ExpectHeader(t, rec.Header(), "Cache-Status", "httpmux; fwd=miss")
+	ExpectTrue(t, cache.Len() == 0)
+}
@@ -0,0 +1,395 @@
+package httpmux
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder compresses the response body for a content coding, e.g. gzip.
+type Encoder interface {
+	// Encoding is the content coding name used in Accept-Encoding.
+	Encoding() string
+
+	// Get returns a writer that compresses into w, the writer is returned
+	// back using Put after it is closed.
+	Get(w io.Writer) io.WriteCloser
+
+	// Put releases the writer, so it can be reused.
+	Put(wc io.WriteCloser)
+}
+
+type pooledEncoder struct {
+	encoding string
+	pool     sync.Pool
+	reset    func(wc io.WriteCloser, w io.Writer)
+}
+
+func (e *pooledEncoder) Encoding() string {
+	return e.encoding
+}
+
+func (e *pooledEncoder) Get(w io.Writer) io.WriteCloser {
+	wc := e.pool.Get().(io.WriteCloser)
+	e.reset(wc, w)
+	return wc
+}
+
+func (e *pooledEncoder) Put(wc io.WriteCloser) {
+	e.pool.Put(wc)
+}
+
+// GzipEncoder creates a pooled gzip Encoder.
+func GzipEncoder(level int) Encoder {
+	e := pooledEncoder{
+		encoding: "gzip",
+		reset: func(wc io.WriteCloser, w io.Writer) {
+			wc.(*gzip.Writer).Reset(w)
+		},
+	}
+
+	e.pool.New = func() interface{} {
+		gw, err := gzip.NewWriterLevel(io.Discard, level)
+		if err != nil {
+			panic(err)
+		}
+
+		return gw
+	}
+
+	return &e
+}
+
+// DeflateEncoder creates a pooled deflate Encoder.
+func DeflateEncoder(level int) Encoder {
+	e := pooledEncoder{
+		encoding: "deflate",
+		reset: func(wc io.WriteCloser, w io.Writer) {
+			wc.(*flate.Writer).Reset(w)
+		},
+	}
+
+	e.pool.New = func() interface{} {
+		fw, err := flate.NewWriter(io.Discard, level)
+		if err != nil {
+			panic(err)
+		}
+
+		return fw
+	}
+
+	return &e
+}
+
+// CompressOptions configures the Compress middleware.
+type CompressOptions struct {
+	// Encoders in the server preference order, used when the client gives
+	// the same q-value. Default is gzip then deflate.
+	Encoders []Encoder
+
+	// MinSize is the minimum body size to compress, default is 1024 bytes.
+	MinSize int
+
+	// SkipContentTypes is a list of media types that are already
+	// compressed. A type ending with "/" matches the whole family, e.g.
+	// "image/". Default is DefaultSkipContentTypes.
+	SkipContentTypes []string
+}
+
+// DefaultSkipContentTypes is the list of already compressed media types.
+var DefaultSkipContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/gzip",
+	"application/zip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/octet-stream",
+	"font/woff",
+	"font/woff2",
+}
+
+// Compress creates a middleware that compresses the response body using the
+// encoding negotiated from the Accept-Encoding header.
+func Compress(opts CompressOptions) Middleware {
+	if len(opts.Encoders) == 0 {
+		opts.Encoders = []Encoder{
+			GzipEncoder(gzip.DefaultCompression),
+			DeflateEncoder(flate.DefaultCompression),
+		}
+	}
+
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+
+	if opts.SkipContentTypes == nil {
+		opts.SkipContentTypes = DefaultSkipContentTypes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoder := negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Encoders)
+			if encoder == nil || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := compressWriter{
+				ResponseWriter: w,
+				encoder:        encoder,
+				opts:           &opts,
+				status:         http.StatusOK,
+			}
+
+			defer cw.close()
+			next.ServeHTTP(&cw, r)
+		})
+	}
+}
+
+type acceptEncoding struct {
+	coding string
+	q      float64
+}
+
+func parseAcceptEncoding(header string) []acceptEncoding {
+	var accepts []acceptEncoding
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		accept := acceptEncoding{coding: part, q: 1}
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			accept.coding = strings.TrimSpace(part[:i])
+			for _, param := range strings.Split(part[i+1:], ";") {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					q, err := strconv.ParseFloat(param[2:], 64)
+					if err != nil {
+						q = 0
+					}
+					accept.q = q
+				}
+			}
+		}
+
+		accept.coding = strings.ToLower(accept.coding)
+		accepts = append(accepts, accept)
+	}
+
+	return accepts
+}
+
+// negotiateEncoding selects the encoder with the highest q-value, ties are
+// broken by the encoders order.
+func negotiateEncoding(header string, encoders []Encoder) Encoder {
+	accepts := parseAcceptEncoding(header)
+	if len(accepts) == 0 {
+		return nil
+	}
+
+	qualities := make(map[string]float64, len(accepts))
+	for _, accept := range accepts {
+		qualities[accept.coding] = accept.q
+	}
+
+	type candidate struct {
+		encoder Encoder
+		q       float64
+	}
+
+	candidates := make([]candidate, 0, len(encoders))
+	for _, encoder := range encoders {
+		q, ok := qualities[encoder.Encoding()]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+
+		if ok && q > 0 {
+			candidates = append(candidates, candidate{encoder: encoder, q: q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	return candidates[0].encoder
+}
+
+// compressWriter buffers the body until MinSize is reached to decide
+// whether the response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	encoder     Encoder
+	opts        *CompressOptions
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	writer      io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	cw.wroteHeader = true
+	cw.status = code
+
+	// the response without body are not compressed.
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		if !cw.compressible() {
+			cw.decide(false)
+		} else {
+			cw.buf = append(cw.buf, b...)
+			if len(cw.buf) < cw.opts.MinSize {
+				return len(b), nil
+			}
+
+			cw.decide(true)
+			return len(b), nil
+		}
+	}
+
+	if cw.writer != nil {
+		return cw.writer.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// compressible checks the headers set by the handler.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, skip := range cw.opts.SkipContentTypes {
+		if strings.HasSuffix(skip, "/") && strings.HasPrefix(contentType, skip) || contentType == skip {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decide writes the header and flushes the buffered body.
+func (cw *compressWriter) decide(compress bool) {
+	if cw.decided {
+		return
+	}
+
+	cw.decided = true
+
+	h := cw.Header()
+	if compress {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(cw.buf))
+		}
+
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoder.Encoding())
+		cw.writer = cw.encoder.Get(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return
+	}
+
+	if cw.writer != nil {
+		_, _ = cw.writer.Write(cw.buf)
+	} else {
+		_, _ = cw.ResponseWriter.Write(cw.buf)
+	}
+
+	cw.buf = nil
+}
+
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader {
+		// the handler didn't write anything, let the server writes the
+		// default response.
+		return
+	}
+
+	// the body is smaller than MinSize.
+	cw.decide(false)
+
+	if cw.writer != nil {
+		_ = cw.writer.Close()
+		cw.encoder.Put(cw.writer)
+		cw.writer = nil
+	}
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	// flushing means the handler is streaming, so don't wait for MinSize.
+	cw.decide(cw.compressible() && len(cw.buf) > 0)
+
+	if f, ok := cw.writer.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("httpmux: response writer does not support hijacking")
+	}
+
+	return h.Hijack()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
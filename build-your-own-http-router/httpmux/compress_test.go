@@ -0,0 +1,128 @@
+package httpmux
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	encoders := []Encoder{GzipEncoder(gzip.DefaultCompression), DeflateEncoder(flate.DefaultCompression)}
+
+	tests := []struct {
+		header   string
+		encoding string
+	}{
+		{header: "", encoding: ""},
+		{header: "gzip", encoding: "gzip"},
+		{header: "deflate, gzip", encoding: "gzip"},
+		{header: "gzip;q=0.5, deflate", encoding: "deflate"},
+		{header: "gzip;q=0, deflate;q=0", encoding: ""},
+		{header: "br", encoding: ""},
+		{header: "br, *;q=0.1", encoding: "gzip"},
+		{header: "*;q=0.1, gzip;q=0", encoding: "deflate"},
+		{header: "GZIP;Q=1", encoding: "gzip"},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.header, func(t *testing.T) {
+			encoding := ""
+			if encoder := negotiateEncoding(tt.header, encoders); encoder != nil {
+				encoding = encoder.Encoding()
+			}
+
+			if encoding != tt.encoding {
+				t.Errorf("expecting %q but got %q", tt.encoding, encoding)
+			}
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"user"}`, 200)
+
+	router := NewRouter()
+	router.Use(Compress(CompressOptions{}))
+	router.HandleFunc(http.MethodGet, "/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for i := 0; i < 200; i++ {
+			_, _ = io.WriteString(w, `{"name":"user"}`)
+		}
+	})
+	router.HandleFunc(http.MethodGet, "/small", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "small")
+	})
+	router.HandleFunc(http.MethodGet, "/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = io.WriteString(w, large)
+	})
+
+	do := func(path string, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		rec := do("/large", "gzip, deflate")
+		ExpectHeader(t, rec.Header(), "Content-Encoding", "gzip")
+		ExpectHeader(t, rec.Header(), "Content-Type", "application/json")
+		ExpectHeader(t, rec.Header(), "Vary", "Accept-Encoding")
+
+		gr, err := gzip.NewReader(rec.Body)
+		ExpectErrNil(t, err)
+		b, err := io.ReadAll(gr)
+		ExpectErrNil(t, err)
+		ExpectTrue(t, string(b) == large)
+	})
+
+	t.Run("deflate", func(t *testing.T) {
+		rec := do("/large", "deflate")
+		ExpectHeader(t, rec.Header(), "Content-Encoding", "deflate")
+
+		b, err := io.ReadAll(flate.NewReader(rec.Body))
+		ExpectErrNil(t, err)
+		ExpectTrue(t, string(b) == large)
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		rec := do("/large", "")
+		ExpectHeader(t, rec.Header(), "Content-Encoding", "")
+		ExpectTrue(t, rec.Body.String() == large)
+	})
+
+	t.Run("tiny body", func(t *testing.T) {
+		rec := do("/small", "gzip")
+		ExpectHeader(t, rec.Header(), "Content-Encoding", "")
+		ExpectHeader(t, rec.Header(), "Vary", "Accept-Encoding")
+		ExpectTrue(t, rec.Body.String() == "small")
+	})
+
+	t.Run("already compressed", func(t *testing.T) {
+		rec := do("/image", "gzip")
+		ExpectHeader(t, rec.Header(), "Content-Encoding", "")
+		ExpectTrue(t, rec.Body.String() == large)
+	})
+}
+
+func BenchmarkCompress(b *testing.B) {
+	handler := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, strings.Repeat(`{"name":"user"}`, 200))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
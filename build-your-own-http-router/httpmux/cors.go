@@ -0,0 +1,189 @@
+package httpmux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins is a list of origins a cross-domain request can be
+	// executed from. An origin may contain a single '*' wildcard, for example
+	// "https://*.example.com". The special value "*" allows all origins.
+	AllowedOrigins []string
+
+	// AllowOriginFunc is a custom function to validate the origin. It is
+	// used when the origin does not match any of AllowedOrigins.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowedHeaders is a list of headers the client is allowed to use. If
+	// empty, the headers requested by the preflight request are reflected.
+	AllowedHeaders []string
+
+	// ExposedHeaders is a list of headers which are safe to expose to the
+	// client.
+	ExposedHeaders []string
+
+	// AllowCredentials indicates whether the request can include user
+	// credentials like cookies or TLS client certificates.
+	AllowCredentials bool
+
+	// MaxAge indicates how long the preflight response can be cached.
+	MaxAge time.Duration
+}
+
+// CORS creates a middleware that handles Cross-Origin Resource Sharing.
+// Preflight requests are answered by the middleware itself, the allowed
+// methods are the methods registered on the matched TrieNode. The middleware
+// must be registered using Router.Use.
+func CORS(opts CORSOptions) Middleware {
+	c := newCORS(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, r, origin, next)
+				return
+			}
+
+			c.actual(w, r, origin)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type originPattern struct {
+	prefix string
+	suffix string
+}
+
+// match reports whether the origin matches the pattern, the wildcard matches
+// at least one character.
+func (p originPattern) match(origin string) bool {
+	return len(origin) > len(p.prefix)+len(p.suffix) &&
+		strings.HasPrefix(origin, p.prefix) &&
+		strings.HasSuffix(origin, p.suffix)
+}
+
+type cors struct {
+	opts     CORSOptions
+	allowAll bool
+	origins  map[string]struct{}
+	patterns []originPattern
+}
+
+func newCORS(opts CORSOptions) *cors {
+	c := cors{
+		opts:    opts,
+		origins: make(map[string]struct{}),
+	}
+
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			c.allowAll = true
+			continue
+		}
+
+		i := strings.IndexByte(origin, '*')
+		if i < 0 {
+			c.origins[origin] = struct{}{}
+			continue
+		}
+
+		c.patterns = append(c.patterns, originPattern{
+			prefix: origin[:i],
+			suffix: origin[i+1:],
+		})
+	}
+
+	return &c
+}
+
+func (c *cors) isOriginAllowed(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if _, ok := c.origins[origin]; ok {
+		return true
+	}
+
+	for _, p := range c.patterns {
+		if p.match(origin) {
+			return true
+		}
+	}
+
+	return c.opts.AllowOriginFunc != nil && c.opts.AllowOriginFunc(origin)
+}
+
+func (c *cors) setAllowOrigin(h http.Header, origin string) {
+	// the wildcard can not be used together with credentials, so the origin
+	// is reflected instead.
+	if c.allowAll && !c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request, origin string, next http.Handler) {
+	node := GetNode(r.Context())
+	if node == nil || len(node.Value) == 0 {
+		// let the router responds the unknown path.
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if !c.isOriginAllowed(origin) {
+		writeError(w, r, http.StatusForbidden, "the origin is not allowed")
+		return
+	}
+
+	c.setAllowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(allowedMethods(node), ", "))
+
+	if len(c.opts.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(c.opts.AllowedHeaders, ", "))
+	} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+
+	if c.opts.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge/time.Second)))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *cors) actual(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	if !c.isOriginAllowed(origin) {
+		return
+	}
+
+	c.setAllowOrigin(h, origin)
+	if len(c.opts.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ", "))
+	}
+}
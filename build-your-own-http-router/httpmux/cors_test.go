@@ -0,0 +1,127 @@
+package httpmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newCORSTestRouter(opts CORSOptions) *Router {
+	router := NewRouter()
+	router.Use(CORS(opts))
+	router.Handle(http.MethodGet, "/v1/users", testHandler("GET /v1/users"))
+	router.Handle(http.MethodPost, "/v1/users", testHandler("POST /v1/users"))
+	router.Handle(http.MethodDelete, "/v1/users/{uid}", testHandler("DELETE /v1/users/{uid}"))
+	router.Handle(MethodAny, "/v1/files", testHandler("* /v1/files"))
+	return router
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	router := newCORSTestRouter(CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	t.Run("advertises registered methods", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/users", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectTrue(t, rec.Code == http.StatusNoContent)
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Origin", "https://app.example.com")
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Methods", "GET, POST")
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Headers", "Content-Type")
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Credentials", "true")
+		ExpectHeader(t, rec.Header(), "Access-Control-Max-Age", "600")
+	})
+
+	t.Run("vars path", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/users/1", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectTrue(t, rec.Code == http.StatusNoContent)
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Methods", "DELETE")
+	})
+
+	t.Run("any method", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/files", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectTrue(t, rec.Code == http.StatusNoContent)
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Methods", "CONNECT, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE")
+	})
+
+	t.Run("origin not allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/users", nil)
+		req.Header.Set("Origin", "https://evil.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectTrue(t, rec.Code == http.StatusForbidden)
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Origin", "")
+	})
+
+	t.Run("empty wildcard", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/users", nil)
+		req.Header.Set("Origin", "https://.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectTrue(t, rec.Code == http.StatusForbidden)
+		ExpectHeader(t, rec.Header(), "Access-Control-Allow-Origin", "")
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/unknown", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectTrue(t, rec.Code == http.StatusNotFound)
+	})
+}
+
+func TestCORS_Actual(t *testing.T) {
+	router := newCORSTestRouter(CORSOptions{
+		AllowedOrigins: []string{"*"},
+		ExposedHeaders: []string{"X-Request-Id"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+	req.Header.Set("Origin", "https://any.com")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectHeader(t, rec.Header(), "Access-Control-Allow-Origin", "*")
+	ExpectHeader(t, rec.Header(), "Access-Control-Expose-Headers", "X-Request-Id")
+	ExpectHeader(t, rec.Header(), "Vary", "Origin")
+}
+
+func ExpectHeader(t *testing.T, header http.Header, key string, value string) {
+	if got := header.Get(key); got != value {
+		t.Helper()
+		t.Errorf("expect header %s is %q; got %q", key, value, got)
+	}
+}
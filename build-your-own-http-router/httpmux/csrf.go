@@ -0,0 +1,314 @@
+package httpmux
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The reasons a request is rejected by the CSRF middleware.
+var (
+	ErrCSRFCrossSite     = errors.New("csrf: the request is cross-site")
+	ErrCSRFOrigin        = errors.New("csrf: the origin is not trusted")
+	ErrCSRFTokenMissing  = errors.New("csrf: the token is missing")
+	ErrCSRFTokenMismatch = errors.New("csrf: the token is invalid")
+)
+
+var csrfContextKey = &contextType{name: "csrf-token"}
+
+// csrfTokenSize is the size of the token in bytes, before it is masked and
+// encoded.
+const csrfTokenSize = 32
+
+// CSRFOptions configures the CSRF middleware.
+type CSRFOptions struct {
+	// Secret switches to synchronizer tokens: the token is derived from the
+	// session by HMAC, so no cookie is used and the token is bound to the
+	// session. Session is required with the Secret. Without the Secret, the
+	// token is a random double-submit cookie.
+	Secret []byte
+
+	// Session identifies the session of the user, e.g. the session id in a
+	// cookie. The requests without a session have no token.
+	Session KeyFunc
+
+	// CookieName is the name of the double-submit cookie. Default is
+	// "__Host-csrf_token", the __Host- prefix makes the browsers reject the
+	// cookie set by a subdomain or over plain HTTP, so a sibling subdomain
+	// can't plant its own token. The default is "csrf_token" when the
+	// prefix is not allowed: with Insecure, a CookieDomain or a CookiePath
+	// other than "/".
+	CookieName string
+
+	// CookiePath is the path of the cookie, default is "/".
+	CookiePath string
+
+	// CookieDomain is the domain of the cookie, default is the host only.
+	CookieDomain string
+
+	// CookieMaxAge is the lifetime of the cookie, default is 12 hours.
+	CookieMaxAge time.Duration
+
+	// Insecure allows the cookie and the Origin over plain HTTP, e.g. in the
+	// development. Otherwise, the Origin of a request received without TLS,
+	// e.g. behind a TLS-terminating proxy, must be https.
+	Insecure bool
+
+	// Header is the request header of the token, default is X-CSRF-Token.
+	Header string
+
+	// FormField is the form field of the token, it is read when the header
+	// is missing. Default is "csrf_token".
+	FormField string
+
+	// TrustedOrigins are the other origins allowed to send the unsafe
+	// requests, e.g. "https://admin.example.com".
+	TrustedOrigins []string
+
+	// ErrorHandler writes the response of a rejected request, the err is
+	// one of the ErrCSRF errors. Default is 403 Forbidden as a Problem.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type csrfMetaKey struct{}
+
+// WithoutCSRF exempts a route from the CSRF middleware, e.g. a webhook that
+// authenticates the requests by a signature.
+func WithoutCSRF() RouteOption {
+	return WithMeta(csrfMetaKey{}, true)
+}
+
+// CSRFToken returns the token of the request, it is set by the CSRF
+// middleware. The token is masked differently for every request, so it can
+// be rendered in the pages served with compression. It returns an empty
+// string when there is no token.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfContextKey).([]byte)
+	if token == nil {
+		return ""
+	}
+
+	return maskCSRFToken(token)
+}
+
+// CSRF creates a middleware that protects the unsafe methods from Cross-Site
+// Request Forgery. The safe methods (GET, HEAD, OPTIONS and TRACE) are
+// exempted. An unsafe request is rejected when the Sec-Fetch-Site header is
+// cross-site or same-site, when its Origin, or its Referer without an Origin,
+// doesn't have the scheme and the host of the request and is not a trusted
+// origin, and when it doesn't send the token in the Header or the FormField.
+// The routes registered with WithoutCSRF are exempted. The middleware must
+// be registered using Router.Use.
+func CSRF(opts CSRFOptions) Middleware {
+	if opts.Secret != nil && opts.Session == nil {
+		panic("httpmux: CSRFOptions.Session is required with the Secret")
+	}
+
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+
+	hostOnly := !opts.Insecure && opts.CookieDomain == "" && opts.CookiePath == "/"
+	if opts.CookieName == "" {
+		opts.CookieName = "csrf_token"
+		if hostOnly {
+			opts.CookieName = "__Host-csrf_token"
+		}
+	}
+
+	if strings.HasPrefix(opts.CookieName, "__Host-") && !hostOnly {
+		panic("httpmux: the __Host- cookie must be secure, without a domain and with the path /")
+	}
+
+	if opts.CookieMaxAge <= 0 {
+		opts.CookieMaxAge = 12 * time.Hour
+	}
+
+	if opts.Header == "" {
+		opts.Header = "X-CSRF-Token"
+	}
+
+	if opts.FormField == "" {
+		opts.FormField = "csrf_token"
+	}
+
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, r, http.StatusForbidden, err.Error())
+		}
+	}
+
+	trusted := make(map[string]struct{}, len(opts.TrustedOrigins))
+	for _, origin := range opts.TrustedOrigins {
+		trusted[strings.ToLower(origin)] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := GetRoute(r.Context()); route != nil && route.Meta(csrfMetaKey{}) == true {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var token []byte
+			issued := false
+			if opts.Secret != nil {
+				if session := opts.Session(r); session != "" {
+					mac := hmac.New(sha256.New, opts.Secret)
+					_, _ = mac.Write([]byte(session))
+					token = mac.Sum(nil)
+				}
+			} else {
+				w.Header().Add("Vary", "Cookie")
+				if cookie, err := r.Cookie(opts.CookieName); err == nil {
+					token, _ = base64.RawURLEncoding.DecodeString(cookie.Value)
+				}
+
+				if len(token) != csrfTokenSize {
+					token = make([]byte, csrfTokenSize)
+					_, _ = rand.Read(token)
+					issued = true
+
+					http.SetCookie(w, &http.Cookie{
+						Name:     opts.CookieName,
+						Value:    base64.RawURLEncoding.EncodeToString(token),
+						Path:     opts.CookiePath,
+						Domain:   opts.CookieDomain,
+						MaxAge:   int(opts.CookieMaxAge.Seconds()),
+						Secure:   !opts.Insecure,
+						HttpOnly: true,
+						SameSite: http.SameSiteLaxMode,
+					})
+				}
+			}
+
+			if token != nil {
+				r = r.WithContext(context.WithValue(r.Context(), csrfContextKey, token))
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := checkCSRFOrigin(r, trusted, opts.Insecure); err != nil {
+				opts.ErrorHandler(w, r, err)
+				return
+			}
+
+			// a new cookie is not sent by the client yet, so the request
+			// can't have the token.
+			if token == nil || issued {
+				opts.ErrorHandler(w, r, ErrCSRFTokenMissing)
+				return
+			}
+
+			submitted := r.Header.Get(opts.Header)
+			if submitted == "" {
+				submitted = r.PostFormValue(opts.FormField)
+			}
+
+			if submitted == "" {
+				opts.ErrorHandler(w, r, ErrCSRFTokenMissing)
+				return
+			}
+
+			if !verifyCSRFToken(submitted, token) {
+				opts.ErrorHandler(w, r, ErrCSRFTokenMismatch)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkCSRFOrigin checks where the request comes from using the Fetch
+// Metadata, the Origin or the Referer, in that order of preference. The
+// origin must have the scheme and the host of the request, the scheme is
+// https unless the request is plain HTTP and insecure is allowed.
+func checkCSRFOrigin(r *http.Request, trusted map[string]struct{}, insecure bool) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && referer.Host != "" {
+			origin = referer.Scheme + "://" + referer.Host
+		}
+	}
+
+	originTrusted := false
+	if origin != "" {
+		if _, ok := trusted[strings.ToLower(origin)]; ok {
+			originTrusted = true
+		}
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	case "same-site", "cross-site":
+		if originTrusted {
+			return nil
+		}
+
+		return ErrCSRFCrossSite
+	}
+
+	// the browsers without the Fetch Metadata send the Origin for the
+	// unsafe requests, the other clients send neither and are left to the
+	// token check.
+	if origin == "" || originTrusted {
+		return nil
+	}
+
+	scheme := "https"
+	if r.TLS == nil && insecure {
+		scheme = "http"
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Scheme, scheme) || !strings.EqualFold(u.Host, r.Host) {
+		return ErrCSRFOrigin
+	}
+
+	return nil
+}
+
+// maskCSRFToken XORs the token with a random pad and prepends the pad, so
+// the token in the responses is different every time and can't be recovered
+// by the compression side channels such as BREACH.
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	pad := masked[:len(token)]
+	_, _ = rand.Read(pad)
+	for i, b := range token {
+		masked[len(token)+i] = b ^ pad[i]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// verifyCSRFToken unmasks the submitted token and compares it to the token
+// in constant time.
+func verifyCSRFToken(submitted string, token []byte) bool {
+	masked, err := base64.RawURLEncoding.DecodeString(submitted)
+	if err != nil || len(masked) != 2*len(token) {
+		return false
+	}
+
+	pad, xored := masked[:len(token)], masked[len(token):]
+	unmasked := make([]byte, len(token))
+	for i := range unmasked {
+		unmasked[i] = xored[i] ^ pad[i]
+	}
+
+	return subtle.ConstantTimeCompare(unmasked, token) == 1
+}
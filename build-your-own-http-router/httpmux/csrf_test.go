@@ -0,0 +1,219 @@
+package httpmux
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newCSRFRouter(opts CSRFOptions) *Router {
+	router := NewRouter()
+	router.Use(CSRF(opts))
+	router.HandleFunc(http.MethodGet, "/form", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, CSRFToken(r.Context()))
+	})
+
+	router.HandleFunc(http.MethodPost, "/form", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	router.HandleFunc(http.MethodPost, "/webhook", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}, WithoutCSRF())
+
+	return router
+}
+
+func TestCSRF_DoubleSubmitCookie(t *testing.T) {
+	router := newCSRFRouter(CSRFOptions{})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/form", nil))
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectHeader(t, rec.Header(), "Vary", "Cookie")
+
+	cookies := rec.Result().Cookies()
+	ExpectTrue(t, len(cookies) == 1 && cookies[0].Name == "__Host-csrf_token" && cookies[0].HttpOnly && cookies[0].Secure)
+	ExpectTrue(t, cookies[0].Path == "/" && cookies[0].Domain == "")
+	cookie := cookies[0]
+	token := rec.Body.String()
+
+	// the token is masked differently for every request.
+	req := httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	ExpectTrue(t, rec.Body.String() != token && len(rec.Result().Cookies()) == 0)
+	otherToken := rec.Body.String()
+
+	post := func(token string, form bool, mutate func(r *http.Request)) *httptest.ResponseRecorder {
+		var req *http.Request
+		if form {
+			req = httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(http.MethodPost, "/form", nil)
+			if token != "" {
+				req.Header.Set("X-CSRF-Token", token)
+			}
+		}
+
+		req.AddCookie(cookie)
+		if mutate != nil {
+			mutate(req)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ExpectTrue(t, post(token, false, nil).Code == http.StatusCreated)
+	ExpectTrue(t, post(otherToken, false, nil).Code == http.StatusCreated)
+	ExpectTrue(t, post(token, true, nil).Code == http.StatusCreated)
+	ExpectTrue(t, post("", false, nil).Code == http.StatusForbidden)
+	ExpectTrue(t, post(token[:len(token)-2]+"AA", false, nil).Code == http.StatusForbidden)
+
+	// the token is useless without the cookie.
+	rec = post(token, false, func(r *http.Request) { r.Header.Del("Cookie") })
+	ExpectTrue(t, rec.Code == http.StatusForbidden && strings.Contains(rec.Body.String(), ErrCSRFTokenMissing.Error()))
+
+	// the cross-site requests are rejected even with a valid token.
+	rec = post(token, false, func(r *http.Request) { r.Header.Set("Sec-Fetch-Site", "cross-site") })
+	ExpectTrue(t, rec.Code == http.StatusForbidden && strings.Contains(rec.Body.String(), ErrCSRFCrossSite.Error()))
+
+	rec = post(token, false, func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") })
+	ExpectTrue(t, rec.Code == http.StatusForbidden && strings.Contains(rec.Body.String(), ErrCSRFOrigin.Error()))
+
+	rec = post(token, false, func(r *http.Request) { r.Header.Set("Referer", "https://evil.example/page") })
+	ExpectTrue(t, rec.Code == http.StatusForbidden)
+
+	rec = post(token, false, func(r *http.Request) { r.Header.Set("Origin", "null") })
+	ExpectTrue(t, rec.Code == http.StatusForbidden)
+
+	// the origin must have the scheme of the site too.
+	rec = post(token, false, func(r *http.Request) { r.Header.Set("Origin", "http://example.com") })
+	ExpectTrue(t, rec.Code == http.StatusForbidden && strings.Contains(rec.Body.String(), ErrCSRFOrigin.Error()))
+
+	rec = post(token, false, func(r *http.Request) { r.Header.Set("Origin", "https://example.com") })
+	ExpectTrue(t, rec.Code == http.StatusCreated)
+
+	rec = post(token, false, func(r *http.Request) { r.Header.Set("Referer", "http://example.com/page") })
+	ExpectTrue(t, rec.Code == http.StatusForbidden)
+
+	rec = post(token, false, func(r *http.Request) {
+		r.Header.Set("Sec-Fetch-Site", "same-origin")
+		r.Header.Set("Origin", "http://example.com")
+	})
+	ExpectTrue(t, rec.Code == http.StatusCreated)
+
+	// the exempted routes skip every check.
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	router.ServeHTTP(rec, req)
+	ExpectTrue(t, rec.Code == http.StatusAccepted && len(rec.Result().Cookies()) == 0)
+}
+
+func TestCSRF_SynchronizerToken(t *testing.T) {
+	router := newCSRFRouter(CSRFOptions{
+		Secret: []byte("secret"),
+		Session: func(r *http.Request) string {
+			cookie, err := r.Cookie("session")
+			if err != nil {
+				return ""
+			}
+
+			return cookie.Value
+		},
+	})
+
+	serve := func(method string, session string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/form", nil)
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: session})
+		}
+
+		if token != "" {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "alice", "")
+	ExpectTrue(t, len(rec.Result().Cookies()) == 0)
+	token := rec.Body.String()
+
+	ExpectTrue(t, serve(http.MethodGet, "", "").Body.String() == "")
+	ExpectTrue(t, serve(http.MethodPost, "alice", token).Code == http.StatusCreated)
+	ExpectTrue(t, serve(http.MethodPost, "bob", token).Code == http.StatusForbidden)
+	ExpectTrue(t, serve(http.MethodPost, "", token).Code == http.StatusForbidden)
+}
+
+func TestCSRF_Options(t *testing.T) {
+	var rejected error
+	router := newCSRFRouter(CSRFOptions{
+		Insecure:       true,
+		Header:         "X-XSRF-Token",
+		TrustedOrigins: []string{"https://admin.example.com"},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			rejected = err
+			http.Redirect(w, r, "/form", http.StatusSeeOther)
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/form", nil))
+	cookie := rec.Result().Cookies()[0]
+	ExpectTrue(t, !cookie.Secure && cookie.Name == "csrf_token")
+
+	req := httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.AddCookie(cookie)
+	req.Header.Set("X-XSRF-Token", rec.Body.String())
+	req.Header.Set("Sec-Fetch-Site", "same-site")
+	req.Header.Set("Origin", "https://admin.example.com")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	ExpectTrue(t, rec.Code == http.StatusCreated)
+
+	req.Header.Set("Origin", "https://blog.example.com")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	ExpectTrue(t, rec.Code == http.StatusSeeOther && errors.Is(rejected, ErrCSRFCrossSite))
+
+	// the plain HTTP origin is allowed when insecure.
+	req.Header.Del("Sec-Fetch-Site")
+	req.Header.Set("Origin", "http://example.com")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	ExpectTrue(t, rec.Code == http.StatusCreated)
+
+	req.Header.Set("Origin", "https://example.com")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	ExpectTrue(t, rec.Code == http.StatusSeeOther && errors.Is(rejected, ErrCSRFOrigin))
+}
+
+func TestCSRF_HostCookie(t *testing.T) {
+	for _, opts := range []CSRFOptions{
+		{CookieDomain: "example.com"},
+		{CookiePath: "/app"},
+	} {
+		rec := httptest.NewRecorder()
+		newCSRFRouter(opts).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/form", nil))
+		ExpectTrue(t, rec.Result().Cookies()[0].Name == "csrf_token")
+	}
+
+	defer func() {
+		ExpectTrue(t, recover() != nil)
+	}()
+
+	CSRF(CSRFOptions{CookieName: "__Host-csrf", Insecure: true})
+}
@@ -0,0 +1,275 @@
+package httpmux
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Explanation tells how the Router matches a request.
+type Explanation struct {
+	Method string `json:"method"`
+	Host   string `json:"host,omitempty"`
+	Path   string `json:"path"`
+
+	// Tries are the visited tries in order, the trie of the host first.
+	Tries []TrieExplanation `json:"tries"`
+
+	// Status is the status the router responds with when no middleware
+	// intercepts the request: 200, 404 or 405.
+	Status  int      `json:"status"`
+	Reason  string   `json:"reason"`
+	Pattern string   `json:"pattern,omitempty"`
+	Vars    Vars     `json:"vars"`
+	Allow   []string `json:"allow,omitempty"`
+}
+
+// TrieExplanation is the lookup of the path in a trie, the empty host is the
+// default trie.
+type TrieExplanation struct {
+	Host    string       `json:"host,omitempty"`
+	Steps   []LookupStep `json:"steps"`
+	Matched bool         `json:"matched"`
+}
+
+// Explain matches the request like the ServeHTTP does, and records the
+// visited nodes.
+func (r *Router) Explain(method string, host string, path string) *Explanation {
+	explanation := &Explanation{
+		Method: method,
+		Host:   host,
+		Path:   path,
+	}
+
+	node, vars := r.find(method, host, path, explanation)
+	explanation.Vars = vars
+
+	if node == nil || len(node.Value) == 0 {
+		explanation.Status = http.StatusNotFound
+		explanation.Reason = "no route matches the path"
+		return explanation
+	}
+
+	route := routeOf(node, method)
+	if route == nil {
+		explanation.Status = http.StatusMethodNotAllowed
+		explanation.Reason = "the method " + method + " is not allowed"
+		explanation.Allow = allowedMethods(node)
+		return explanation
+	}
+
+	explanation.Status = http.StatusOK
+	explanation.Reason = "the route " + route.Method + " " + route.Pattern + " matches"
+	explanation.Pattern = route.Pattern
+	return explanation
+}
+
+// DebugHandler creates a handler that shows the routing state of the router,
+// it should be mounted on a path that only the operators can reach, e.g.
+//
+//	router.HandlePattern("GET /debug/router/", httpmux.DebugHandler(router))
+//
+// The paths that end with /explain explain how a request is matched, the
+// request is given by the method, host and path query parameters. The other
+// paths render the trie of the host query parameter, or the default trie.
+// The format query parameter is text (default) or json, and dot for the
+// trie.
+func DebugHandler(router *Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		format := query.Get("format")
+
+		if strings.HasSuffix(r.URL.Path, "/explain") {
+			path := query.Get("path")
+			if path == "" {
+				writeError(w, r, http.StatusBadRequest, "the path query parameter is required")
+				return
+			}
+
+			method := query.Get("method")
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			explanation := router.Explain(method, query.Get("host"), path)
+			switch format {
+			case "json":
+				writeDebugJSON(w, explanation)
+			case "", "text":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				writeExplanationText(w, explanation)
+			default:
+				writeError(w, r, http.StatusBadRequest, "the format "+format+" is not supported")
+			}
+
+			return
+		}
+
+		trie := router.trie
+		if host := query.Get("host"); host != "" {
+			var ok bool
+			if trie, ok = router.hosts[hostname(host)]; !ok {
+				writeError(w, r, http.StatusNotFound, "the host "+host+" has no routes")
+				return
+			}
+		}
+
+		switch format {
+		case "json":
+			writeDebugJSON(w, newDebugNode(trie.root))
+		case "dot":
+			w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+			writeTrieDOT(w, trie)
+		case "", "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writeTrieText(w, trie.root, "", "")
+		default:
+			writeError(w, r, http.StatusBadRequest, "the format "+format+" is not supported")
+		}
+	})
+}
+
+// debugNode is the JSON representation of a TrieNode.
+type debugNode struct {
+	Label    string            `json:"label"`
+	Kind     NodeKind          `json:"kind"`
+	Methods  []string          `json:"methods,omitempty"`
+	Routes   map[string]string `json:"routes,omitempty"`
+	Children []*debugNode      `json:"children,omitempty"`
+}
+
+func newDebugNode(node *TrieNode) *debugNode {
+	dn := &debugNode{
+		Label: node.Label,
+		Kind:  node.Kind,
+	}
+
+	if len(node.Value) > 0 {
+		dn.Methods = node.Methods()
+		dn.Routes = make(map[string]string, len(node.Value))
+		for method, handler := range node.Value {
+			if route, ok := handler.(*Route); ok {
+				dn.Routes[method] = route.Pattern
+			}
+		}
+	}
+
+	for _, label := range childLabels(node) {
+		dn.Children = append(dn.Children, newDebugNode(node.Children[label]))
+	}
+
+	return dn
+}
+
+func writeDebugJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// writeTrieText writes the trie as a tree, e.g.
+//
+//	/ (root)
+//	└── users (path) [GET, POST]
+//	    └── {uid} (vars) [GET]
+func writeTrieText(w io.Writer, node *TrieNode, prefix string, childPrefix string) {
+	line := prefix + displayLabel(node) + " (" + string(node.Kind) + ")"
+	if len(node.Value) > 0 {
+		line += " [" + strings.Join(node.Methods(), ", ") + "]"
+	}
+
+	_, _ = io.WriteString(w, line+"\n")
+
+	labels := childLabels(node)
+	for i, label := range labels {
+		if i == len(labels)-1 {
+			writeTrieText(w, node.Children[label], childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			writeTrieText(w, node.Children[label], childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+func writeTrieDOT(w io.Writer, trie *Trie) {
+	_, _ = io.WriteString(w, "digraph trie {\n\tnode [shape=box];\n")
+
+	ids := make(map[*TrieNode]int)
+	trie.Walk(func(node *TrieNode) {
+		id := len(ids)
+		ids[node] = id
+
+		lines := []string{displayLabel(node), string(node.Kind)}
+		if len(node.Value) > 0 {
+			lines = append(lines, strings.Join(node.Methods(), ", "))
+		}
+
+		_, _ = fmt.Fprintf(w, "\tn%d [label=%s];\n", id, dotQuote(lines))
+	})
+
+	trie.Walk(func(node *TrieNode) {
+		for _, label := range childLabels(node) {
+			_, _ = fmt.Fprintf(w, "\tn%d -> n%d;\n", ids[node], ids[node.Children[label]])
+		}
+	})
+
+	_, _ = io.WriteString(w, "}\n")
+}
+
+func writeExplanationText(w io.Writer, e *Explanation) {
+	_, _ = fmt.Fprintf(w, "%s %s%s\n", e.Method, e.Host, e.Path)
+	for _, t := range e.Tries {
+		name := "default"
+		if t.Host != "" {
+			name = t.Host
+		}
+
+		_, _ = fmt.Fprintf(w, "\ntrie %s:\n", name)
+		for _, step := range t.Steps {
+			node := displayLabel(&TrieNode{Label: step.Label, Kind: step.Kind})
+			_, _ = fmt.Fprintf(w, "  %s[%d] %q -> %s (%s): %s\n", strings.Repeat("  ", step.Depth), step.Depth, step.Segment, node, step.Kind, step.Note)
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "\nresult: %d %s\n", e.Status, e.Reason)
+	for _, v := range e.Vars {
+		_, _ = fmt.Fprintf(w, "var %s = %q\n", v.Name, v.Value)
+	}
+
+	if len(e.Allow) > 0 {
+		_, _ = fmt.Fprintf(w, "allow: %s\n", strings.Join(e.Allow, ", "))
+	}
+}
+
+// dotQuote quotes the lines as a DOT string, the lines are separated by the
+// DOT line break.
+func dotQuote(lines []string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	for i, line := range lines {
+		lines[i] = escaper.Replace(line)
+	}
+
+	return `"` + strings.Join(lines, `\n`) + `"`
+}
+
+// displayLabel returns the label as written in the patterns.
+func displayLabel(node *TrieNode) string {
+	switch node.Kind {
+	case RootNode:
+		return "/"
+	case VarsNode:
+		return "{" + node.Label + "}"
+	case CatchAllNode:
+		return "{" + node.Label + "...}"
+	case PathNode:
+		if node.Label == "" {
+			return `""`
+		}
+
+		return node.Label
+	default:
+		return node.Label
+	}
+}
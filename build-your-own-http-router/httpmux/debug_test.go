@@ -0,0 +1,107 @@
+package httpmux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newDebugTestRouter() *Router {
+	noop := func(http.ResponseWriter, *http.Request) {}
+
+	router := NewRouter()
+	router.HandleFunc(http.MethodGet, "/users", noop)
+	router.HandleFunc(http.MethodPost, "/users", noop)
+	router.HandleFunc(http.MethodGet, "/users/{uid}", noop)
+	router.HandleFunc(http.MethodGet, "/users/me/settings", noop)
+	router.HandlePatternFunc("GET /files/{path...}", noop)
+	router.HandlePattern("GET /debug/router/", DebugHandler(router))
+	return router
+}
+
+func TestDebugHandler_Trie(t *testing.T) {
+	router := newDebugTestRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/router/trie", nil))
+
+	expected := `/ (root)
+├── debug (path)
+│   └── router (path)
+│       └── {...} (catch-all) [GET]
+├── files (path)
+│   └── {path...} (catch-all) [GET]
+└── users (path) [GET, POST]
+    ├── {uid} (vars) [GET]
+    └── me (path)
+        └── settings (path) [GET]
+`
+	if rec.Body.String() != expected {
+		t.Fatalf("expected tree:\n%s\ngot:\n%s", expected, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/router/trie?format=json", nil))
+	ExpectHeader(t, rec.Header(), "Content-Type", "application/json")
+
+	var root debugNode
+	ExpectErrNil(t, json.NewDecoder(rec.Body).Decode(&root))
+	users := root.Children[2]
+	ExpectTrue(t, users.Label == "users" && strings.Join(users.Methods, ",") == "GET,POST")
+	ExpectTrue(t, users.Children[0].Kind == VarsNode && users.Children[0].Routes["GET"] == "/users/{uid}")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/router/trie?format=dot", nil))
+	body := rec.Body.String()
+	ExpectTrue(t, strings.HasPrefix(body, "digraph trie {"))
+	ExpectTrue(t, strings.Contains(body, `[label="{uid}\nvars\nGET"]`))
+	ExpectTrue(t, strings.Count(body, "->") == 9)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/router/trie?format=xml", nil))
+	ExpectTrue(t, rec.Code == http.StatusBadRequest)
+}
+
+func TestRouter_Explain(t *testing.T) {
+	router := newDebugTestRouter()
+
+	// the static branch "me" has no handlers, so the lookup backtracks to
+	// the vars.
+	e := router.Explain(http.MethodGet, "", "/users/me")
+	ExpectTrue(t, e.Status == http.StatusOK && e.Pattern == "/users/{uid}")
+	ExpectTrue(t, e.Vars.ByName("uid") == "me")
+
+	var notes []string
+	for _, step := range e.Tries[0].Steps {
+		notes = append(notes, step.Label+": "+step.Note)
+	}
+
+	expected := []string{
+		"users: the static child matches the segment",
+		"me: the static child matches the segment",
+		"me: end of the path, the node has no handlers",
+		"me: backtrack, the static branch has no match",
+		"uid: the vars child captures the segment",
+		"uid: end of the path, the node has handlers",
+	}
+	if strings.Join(notes, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected steps:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(notes, "\n"))
+	}
+
+	e = router.Explain(http.MethodDelete, "", "/users")
+	ExpectTrue(t, e.Status == http.StatusMethodNotAllowed && strings.Join(e.Allow, ",") == "GET,POST")
+
+	e = router.Explain(http.MethodGet, "", "/orders/1")
+	ExpectTrue(t, e.Status == http.StatusNotFound && !e.Tries[0].Matched)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/router/explain?path=/files/a/b.txt", nil))
+	ExpectTrue(t, strings.Contains(rec.Body.String(), "result: 200 the route GET /files/{path...} matches"))
+	ExpectTrue(t, strings.Contains(rec.Body.String(), `var path = "a/b.txt"`))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/router/explain", nil))
+	ExpectTrue(t, rec.Code == http.StatusBadRequest)
+}
@@ -0,0 +1,297 @@
+package httpmux
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagOptions configures the ETag middleware.
+type ETagOptions struct {
+	// MaxBufferSize is the maximum response size to buffer, bigger
+	// responses are streamed without ETag. Default is 1 MiB.
+	MaxBufferSize int
+
+	// Weak makes the generated ETags weak, e.g. when the representation is
+	// semantically equivalent but may differ byte by byte.
+	Weak bool
+
+	// Validator is the Validator of the routes registered without
+	// WithValidator.
+	Validator Validator
+}
+
+// Validator returns the validators of the current representation of the
+// requested resource, ok is false when the resource does not exist. The
+// etag must be quoted, e.g. `"v2"`, and the zero modTime means unknown.
+type Validator func(r *http.Request) (etag string, modTime time.Time, ok bool)
+
+type validatorMetaKey struct{}
+
+// WithValidator declares how the ETag middleware gets the current ETag and
+// modification time of the resource when it checks the If-Match and
+// If-Unmodified-Since of the unsafe methods.
+func WithValidator(v Validator) RouteOption {
+	return WithMeta(validatorMetaKey{}, v)
+}
+
+// ETag creates a middleware that adds caching semantics to the routes.
+//
+// For GET and HEAD requests the response is buffered, the ETag is computed
+// from the body unless the handler sets it, and If-None-Match or
+// If-Modified-Since are answered with 304 Not Modified.
+//
+// For unsafe methods with If-Match or If-Unmodified-Since, the current
+// validators are taken from the Validator of the route, and the request is
+// rejected with 412 Precondition Failed if the precondition is not met. The
+// routes without a Validator handle the preconditions themselves.
+func ETag(opts ETagOptions) Middleware {
+	if opts.MaxBufferSize <= 0 {
+		opts.MaxBufferSize = 1 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the upgraded connections, e.g. WebSocket, can not be buffered.
+			if GetRoute(r.Context()) == nil || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				serveConditionalGet(w, r, next, &opts)
+			case http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+			default:
+				if !checkPreconditions(w, r, opts.Validator) {
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func serveConditionalGet(w http.ResponseWriter, r *http.Request, next http.Handler, opts *ETagOptions) {
+	bw := bufferedWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+		limit:          opts.MaxBufferSize,
+	}
+
+	next.ServeHTTP(&bw, r)
+	if bw.overflow {
+		return
+	}
+
+	h := w.Header()
+	if bw.status != http.StatusOK {
+		bw.flush()
+		return
+	}
+
+	etag := h.Get("ETag")
+	if etag == "" {
+		etag = computeETag(bw.buf.Bytes(), opts.Weak)
+		h.Set("ETag", etag)
+	}
+
+	if notModified(r, etag, h.Get("Last-Modified")) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	bw.flush()
+}
+
+func notModified(r *http.Request, etag string, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETags(inm, etag, false)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+
+	return notModifiedSince(lastModified, ims)
+}
+
+func checkPreconditions(w http.ResponseWriter, r *http.Request, validator Validator) bool {
+	ifMatch := r.Header.Get("If-Match")
+	ius := r.Header.Get("If-Unmodified-Since")
+	if ifMatch == "" && ius == "" {
+		return true
+	}
+
+	if v, ok := GetRoute(r.Context()).Meta(validatorMetaKey{}).(Validator); ok {
+		validator = v
+	}
+
+	if validator == nil {
+		return true
+	}
+
+	etag, modTime, exists := validator(r)
+
+	var ok bool
+	if ifMatch != "" {
+		ok = exists && (strings.TrimSpace(ifMatch) == "*" || matchETags(ifMatch, etag, true))
+	} else {
+		ok = exists && !modTime.IsZero() && notModifiedSince(modTime.UTC().Format(http.TimeFormat), ius)
+	}
+
+	if !ok {
+		writeError(w, r, http.StatusPreconditionFailed, "the precondition is not met by the current representation")
+	}
+
+	return ok
+}
+
+func computeETag(body []byte, weak bool) string {
+	sum := sha1.Sum(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+
+	return etag
+}
+
+// matchETags reports whether the etag is in the comma separated list, using
+// the strong or the weak comparison as defined by RFC 7232 section 2.3.2.
+func matchETags(list string, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func notModifiedSince(lastModified string, since string) bool {
+	lm, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+
+	t, err := http.ParseTime(since)
+	if err != nil {
+		return false
+	}
+
+	return !lm.Truncate(time.Second).After(t)
+}
+
+// bufferedWriter buffers the response body up to the limit, after that the
+// response is streamed to the client. A flush by the handler streams the
+// response too, so the streaming handlers are not delayed.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	limit       int
+	overflow    bool
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	if bw.wroteHeader {
+		return
+	}
+
+	bw.wroteHeader = true
+	bw.status = code
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+
+	if bw.overflow {
+		return bw.ResponseWriter.Write(b)
+	}
+
+	if bw.buf.Len()+len(b) > bw.limit {
+		bw.overflow = true
+		bw.flush()
+		return bw.ResponseWriter.Write(b)
+	}
+
+	return bw.buf.Write(b)
+}
+
+func (bw *bufferedWriter) Flush() {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+
+	if !bw.overflow {
+		bw.overflow = true
+		bw.flush()
+	}
+
+	_ = http.NewResponseController(bw.ResponseWriter).Flush()
+}
+
+func (bw *bufferedWriter) flush() {
+	bw.ResponseWriter.WriteHeader(bw.status)
+	if bw.buf.Len() > 0 {
+		_, _ = bw.ResponseWriter.Write(bw.buf.Bytes())
+		bw.buf.Reset()
+	}
+}
+
+func (bw *bufferedWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// recorderWriter records the response in memory, like
+// httptest.ResponseRecorder.
+type recorderWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (rw *recorderWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *recorderWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+
+	rw.wroteHeader = true
+	rw.status = code
+}
+
+func (rw *recorderWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.buf.Write(b)
+}
@@ -0,0 +1,145 @@
+package httpmux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag_ConditionalGet(t *testing.T) {
+	lastModified := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	router := NewRouter()
+	router.Use(ETag(ETagOptions{MaxBufferSize: 16}))
+	router.HandleFunc(http.MethodGet, "/v1/users/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		_, _ = io.WriteString(w, "user "+GetVars(r.Context()).ByName("uid"))
+	})
+	router.HandleFunc(http.MethodGet, "/large", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 10))
+		_, _ = io.WriteString(w, strings.Repeat("x", 10))
+	})
+
+	do := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/v1/users/1", nil)
+	etag := rec.Header().Get("ETag")
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectTrue(t, rec.Body.String() == "user 1")
+	ExpectTrue(t, etag != "" && !strings.HasPrefix(etag, "W/"))
+
+	rec = do("/v1/users/1", http.Header{"If-None-Match": {`"other", ` + etag}})
+	ExpectTrue(t, rec.Code == http.StatusNotModified)
+	ExpectTrue(t, rec.Body.Len() == 0)
+	ExpectHeader(t, rec.Header(), "ETag", etag)
+
+	rec = do("/v1/users/1", http.Header{"If-None-Match": {"W/" + etag}})
+	ExpectTrue(t, rec.Code == http.StatusNotModified)
+
+	rec = do("/v1/users/2", http.Header{"If-None-Match": {etag}})
+	ExpectTrue(t, rec.Code == http.StatusOK)
+
+	rec = do("/v1/users/1", http.Header{"If-Modified-Since": {lastModified.Add(time.Hour).Format(http.TimeFormat)}})
+	ExpectTrue(t, rec.Code == http.StatusNotModified)
+
+	rec = do("/v1/users/1", http.Header{"If-Modified-Since": {lastModified.Add(-time.Hour).Format(http.TimeFormat)}})
+	ExpectTrue(t, rec.Code == http.StatusOK)
+
+	rec = do("/large", nil)
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectTrue(t, rec.Body.Len() == 20)
+	ExpectHeader(t, rec.Header(), "ETag", "")
+}
+
+func TestETag_Preconditions(t *testing.T) {
+	name := "jose"
+	version := 1
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	gets := 0
+
+	validator := func(r *http.Request) (string, time.Time, bool) {
+		return `"v` + strconv.Itoa(version) + `"`, modTime, true
+	}
+
+	router := NewRouter()
+	router.Use(ETag(ETagOptions{}))
+	router.HandleFunc(http.MethodGet, "/v1/users/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		_, _ = io.WriteString(w, name)
+	})
+	router.HandleFunc(http.MethodPut, "/v1/users/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		name = string(b)
+		version++
+		modTime = modTime.Add(time.Hour)
+		w.WriteHeader(http.StatusNoContent)
+	}, WithValidator(validator))
+	router.HandleFunc(http.MethodPut, "/v1/posts/{pid}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, WithValidator(func(r *http.Request) (string, time.Time, bool) {
+		return "", time.Time{}, false
+	}))
+	router.HandleFunc(http.MethodPut, "/v1/tags/{tid}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	put := func(path string, header string, value string, body string) int {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set(header, value)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	ExpectTrue(t, put("/v1/users/1", "If-Match", `"v1"`, "stg") == http.StatusNoContent)
+	ExpectTrue(t, name == "stg")
+
+	// the representation has changed.
+	ExpectTrue(t, put("/v1/users/1", "If-Match", `"v1"`, "jose") == http.StatusPreconditionFailed)
+	ExpectTrue(t, name == "stg")
+
+	ExpectTrue(t, put("/v1/users/1", "If-Match", "*", "jose") == http.StatusNoContent)
+	ExpectTrue(t, put("/v1/users/1", "If-Match", `W/"v3"`, "stg") == http.StatusPreconditionFailed)
+
+	since := modTime.Format(http.TimeFormat)
+	ExpectTrue(t, put("/v1/users/1", "If-Unmodified-Since", since, "stg") == http.StatusNoContent)
+	ExpectTrue(t, put("/v1/users/1", "If-Unmodified-Since", since, "jose") == http.StatusPreconditionFailed)
+
+	// the preconditions don't run the GET handler.
+	ExpectTrue(t, gets == 0)
+
+	// the resource does not exist.
+	ExpectTrue(t, put("/v1/posts/1", "If-Match", "*", "") == http.StatusPreconditionFailed)
+
+	// the routes without a validator check the preconditions themselves.
+	ExpectTrue(t, put("/v1/tags/1", "If-Match", `"v1"`, "") == http.StatusNoContent)
+}
+
+func TestETag_Flush(t *testing.T) {
+	router := NewRouter()
+	router.Use(ETag(ETagOptions{}))
+	router.HandleFunc(http.MethodGet, "/events", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "first")
+		_ = http.NewResponseController(w).Flush()
+		_, _ = io.WriteString(w, "second")
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	ExpectTrue(t, rec.Flushed && rec.Body.String() == "firstsecond")
+	ExpectHeader(t, rec.Header(), "ETag", "")
+}
@@ -0,0 +1,163 @@
+package httpmux
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cUpgradeMaxBody is the limit of the upgraded request body, h2c reads it
+// into memory before the upgrade.
+const h2cUpgradeMaxBody = 1 << 20
+
+var (
+	connContextKey   = &contextType{name: "conn"}
+	streamContextKey = &contextType{name: "stream"}
+)
+
+// StreamInfo describes how a request is received, it is an HTTP/2 stream or
+// an HTTP/1 request.
+type StreamInfo struct {
+	// ConnID identifies the connection, it is unique within the Server.
+	ConnID uint64
+
+	// Seq is the order of the request on the connection, starting from 1.
+	// The HTTP/2 streams of a connection are concurrent, so the requests
+	// with a higher Seq may finish first.
+	Seq uint64
+
+	// Proto is the protocol of the request, e.g. "HTTP/2.0".
+	Proto string
+
+	// H2C reports whether the request is a cleartext HTTP/2 stream.
+	H2C bool
+
+	// TLS is the state of the TLS connection, it is nil for the cleartext
+	// connections.
+	TLS *tls.ConnectionState
+
+	LocalAddr  string
+	RemoteAddr string
+}
+
+// HTTP2 reports whether the request is an HTTP/2 stream.
+func (s *StreamInfo) HTTP2() bool {
+	return s.Proto == "HTTP/2.0"
+}
+
+// GetStreamInfo returns the StreamInfo of a request served by the Server, it
+// returns nil for the other requests.
+func GetStreamInfo(ctx context.Context) *StreamInfo {
+	info, _ := ctx.Value(streamContextKey).(*StreamInfo)
+	return info
+}
+
+// connInfo is stored in the context of every connection accepted by the
+// Server.
+type connInfo struct {
+	id        uint64
+	localAddr string
+	requests  atomic.Uint64
+}
+
+// connContext assigns an ID to the connection, it wraps the ConnContext of
+// the underlying server.
+func (s *Server) connContext(next func(context.Context, net.Conn) context.Context) func(context.Context, net.Conn) context.Context {
+	return func(ctx context.Context, c net.Conn) context.Context {
+		if next != nil {
+			ctx = next(ctx, c)
+		}
+
+		info := &connInfo{
+			id:        s.connIDs.Add(1),
+			localAddr: c.LocalAddr().String(),
+		}
+
+		return context.WithValue(ctx, connContextKey, info)
+	}
+}
+
+// serveStream adds the StreamInfo to the request context before the router
+// serves the request.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	conn, ok := r.Context().Value(connContextKey).(*connInfo)
+	if !ok {
+		s.router.ServeHTTP(w, r)
+		return
+	}
+
+	info := &StreamInfo{
+		ConnID:     conn.id,
+		Seq:        conn.requests.Add(1),
+		Proto:      r.Proto,
+		H2C:        r.ProtoMajor == 2 && r.TLS == nil,
+		TLS:        r.TLS,
+		LocalAddr:  conn.localAddr,
+		RemoteAddr: r.RemoteAddr,
+	}
+
+	s.router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), streamContextKey, info)))
+}
+
+// h2cUpgrade serves the cleartext HTTP/1.1 requests with the Upgrade: h2c
+// header as the first stream of an HTTP/2 connection, as defined by RFC 7540
+// section 3.2. The other requests are served by next.
+func (s *Server) h2cUpgrade(next http.Handler) http.Handler {
+	h2s := &http2.Server{IdleTimeout: s.srv.IdleTimeout}
+
+	// ConfigureServer is called on a detached server, so the TLS and the
+	// prior knowledge stay with net/http. It only tracks the upgraded
+	// connections, which get a GOAWAY when the detached server shuts down.
+	upgraded := &http.Server{}
+	_ = http2.ConfigureServer(upgraded, h2s)
+	s.srv.RegisterOnShutdown(func() {
+		_ = upgraded.Shutdown(context.Background())
+	})
+
+	// the upgraded request is the stream 1 of the connection, but h2c keeps
+	// its HTTP/1.1 proto and headers.
+	upgrade := h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 1 {
+			r = r.WithContext(r.Context())
+			r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/2.0", 2, 0
+			r.Header = r.Header.Clone()
+			for _, name := range []string{"Connection", "Upgrade", "HTTP2-Settings"} {
+				r.Header.Del(name)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}), h2s)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 1 || r.TLS != nil || !isH2CUpgrade(r.Header) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the hijacked connection is counted until the HTTP/2 connection is
+		// closed.
+		s.upgrades.Add(1)
+		atomic.AddInt64(&s.activeConns, 1)
+		defer func() {
+			atomic.AddInt64(&s.activeConns, -1)
+			s.upgrades.Done()
+		}()
+
+		r.Body = http.MaxBytesReader(w, r.Body, h2cUpgradeMaxBody)
+		upgrade.ServeHTTP(w, r)
+	})
+}
+
+// isH2CUpgrade reports whether the request asks for the upgrade to h2c, the
+// HTTP2-Settings header must be named by the Connection header.
+func isH2CUpgrade(h http.Header) bool {
+	return httpguts.HeaderValuesContainsToken(h["Upgrade"], "h2c") &&
+		httpguts.HeaderValuesContainsToken(h["Connection"], "HTTP2-Settings")
+}
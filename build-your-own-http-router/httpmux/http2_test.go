@@ -0,0 +1,290 @@
+package httpmux
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// newTestCertificate generates a self-signed certificate for 127.0.0.1.
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ExpectErrNil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "httpmux test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	ExpectErrNil(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	ExpectErrNil(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+type testStreamResponse struct {
+	ConnID uint64 `json:"conn_id"`
+	Seq    uint64 `json:"seq"`
+	Proto  string `json:"proto"`
+	H2C    bool   `json:"h2c"`
+	ALPN   string `json:"alpn"`
+}
+
+// startStreamServer serves a router that responds with the StreamInfo.
+func startStreamServer(t *testing.T, opts ServerOptions) string {
+	t.Helper()
+
+	router := NewRouter()
+	router.HandleFunc(http.MethodGet, "/stream", func(w http.ResponseWriter, r *http.Request) {
+		info := GetStreamInfo(r.Context())
+		if info == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res := testStreamResponse{ConnID: info.ConnID, Seq: info.Seq, Proto: info.Proto, H2C: info.H2C}
+		if info.TLS != nil {
+			res.ALPN = info.TLS.NegotiatedProtocol
+		}
+
+		_ = json.NewEncoder(w).Encode(res)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	ExpectErrNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- NewServer(router, opts).Serve(ctx, l)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		ExpectErrNil(t, <-served)
+	})
+
+	return l.Addr().String()
+}
+
+func getStream(t *testing.T, client *http.Client, url string, header http.Header) testStreamResponse {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	ExpectErrNil(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Errorf("expect error nil; got %v", err)
+		return testStreamResponse{}
+	}
+	defer res.Body.Close()
+
+	var body testStreamResponse
+	ExpectErrNil(t, json.NewDecoder(res.Body).Decode(&body))
+	ExpectTrue(t, res.StatusCode == http.StatusOK)
+	ExpectTrue(t, res.Proto == body.Proto)
+	return body
+}
+
+func TestServer_HTTP2OverTLS(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	addr := startStreamServer(t, ServerOptions{
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	})
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	defer client.CloseIdleConnections()
+
+	// the concurrent requests are the streams of one connection.
+	var wg sync.WaitGroup
+	responses := make([]testStreamResponse, 4)
+	first := getStream(t, client, "https://"+addr+"/stream", nil)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = getStream(t, client, "https://"+addr+"/stream", nil)
+		}(i)
+	}
+	wg.Wait()
+
+	ExpectTrue(t, first.Proto == "HTTP/2.0" && first.ALPN == "h2" && !first.H2C && first.Seq == 1)
+
+	seqs := make(map[uint64]bool)
+	for _, res := range responses {
+		ExpectTrue(t, res.Proto == "HTTP/2.0" && res.ConnID == first.ConnID)
+		seqs[res.Seq] = true
+	}
+	ExpectTrue(t, len(seqs) == len(responses) && !seqs[first.Seq])
+
+	// the clients without HTTP/2 fall back to HTTP/1.1.
+	http1 := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+		TLSNextProto:    map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}}
+	defer http1.CloseIdleConnections()
+
+	res := getStream(t, http1, "https://"+addr+"/stream", nil)
+	ExpectTrue(t, res.Proto == "HTTP/1.1" && res.ALPN != "h2" && res.ConnID != first.ConnID)
+}
+
+func TestServer_H2C(t *testing.T) {
+	addr := startStreamServer(t, ServerOptions{H2C: true})
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	h2c := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	defer h2c.CloseIdleConnections()
+
+	first := getStream(t, h2c, "http://"+addr+"/stream", nil)
+	second := getStream(t, h2c, "http://"+addr+"/stream", nil)
+	ExpectTrue(t, first.Proto == "HTTP/2.0" && first.H2C && first.ALPN == "")
+	ExpectTrue(t, second.ConnID == first.ConnID && second.Seq == first.Seq+1)
+
+	// the HTTP/1.1 clients are still served.
+	http1 := &http.Client{Transport: &http.Transport{}}
+	defer http1.CloseIdleConnections()
+
+	res := getStream(t, http1, "http://"+addr+"/stream", nil)
+	ExpectTrue(t, res.Proto == "HTTP/1.1" && !res.H2C && res.ConnID != first.ConnID)
+}
+
+// The Go client doesn't upgrade to h2c, so the test speaks the frames of
+// RFC 7540 section 3.2 itself.
+func TestServer_H2CUpgrade(t *testing.T) {
+	addr := startStreamServer(t, ServerOptions{H2C: true})
+
+	conn, err := net.Dial("tcp", addr)
+	ExpectErrNil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = io.WriteString(conn, "GET /stream HTTP/1.1\r\n"+
+		"Host: "+addr+"\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: AAMAAABkAAQAoAAAAAIAAAAA\r\n\r\n")
+	ExpectErrNil(t, err)
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	ExpectErrNil(t, err)
+	ExpectTrue(t, res.StatusCode == http.StatusSwitchingProtocols)
+	ExpectTrue(t, res.Header.Get("Upgrade") == "h2c")
+
+	// the client preface, then the response of the upgraded request is the
+	// stream 1.
+	_, err = io.WriteString(conn, http2.ClientPreface)
+	ExpectErrNil(t, err)
+
+	framer := http2.NewFramer(conn, br)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	ExpectErrNil(t, framer.WriteSettings())
+
+	// readStream reads the response of the stream, answering the settings.
+	readStream := func(streamID uint32) (string, testStreamResponse) {
+		var (
+			status string
+			body   bytes.Buffer
+		)
+
+		for done := false; !done; {
+			frame, err := framer.ReadFrame()
+			ExpectErrNil(t, err)
+
+			switch f := frame.(type) {
+			case *http2.SettingsFrame:
+				if !f.IsAck() {
+					ExpectErrNil(t, framer.WriteSettingsAck())
+				}
+			case *http2.MetaHeadersFrame:
+				ExpectTrue(t, f.StreamID == streamID)
+				status = f.PseudoValue("status")
+				done = f.StreamEnded()
+			case *http2.DataFrame:
+				ExpectTrue(t, f.StreamID == streamID)
+				body.Write(f.Data())
+				done = f.StreamEnded()
+			}
+		}
+
+		var info testStreamResponse
+		ExpectErrNil(t, json.Unmarshal(body.Bytes(), &info))
+		return status, info
+	}
+
+	status, first := readStream(1)
+	ExpectTrue(t, status == "200")
+	ExpectTrue(t, first.Proto == "HTTP/2.0" && first.H2C && first.Seq == 1)
+
+	// the next request is a stream of the same connection.
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, field := range [][2]string{{":method", "GET"}, {":scheme", "http"}, {":authority", addr}, {":path", "/stream"}} {
+		ExpectErrNil(t, enc.WriteField(hpack.HeaderField{Name: field[0], Value: field[1]}))
+	}
+
+	ExpectErrNil(t, framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      3,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	}))
+
+	status, second := readStream(3)
+	ExpectTrue(t, status == "200")
+	ExpectTrue(t, second.Proto == "HTTP/2.0" && second.ConnID == first.ConnID && second.Seq == 2)
+}
+
+func TestServer_WithoutH2C(t *testing.T) {
+	addr := startStreamServer(t, ServerOptions{})
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	h2c := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	defer h2c.CloseIdleConnections()
+
+	_, err := h2c.Get("http://" + addr + "/stream")
+	ExpectTrue(t, err != nil)
+
+	res := getStream(t, http.DefaultClient, "http://"+addr+"/stream", nil)
+	ExpectTrue(t, res.Proto == "HTTP/1.1" && !res.H2C)
+}
@@ -3,11 +3,19 @@ package httpmux
 import (
 	"context"
 	"net/http"
+	"sort"
+	"strings"
 )
 
-type contextType struct{}
+type contextType struct {
+	name string
+}
 
-var varsContextKey = &contextType{}
+var (
+	varsContextKey     = &contextType{name: "vars"}
+	nodeContextKey     = &contextType{name: "node"}
+	observerContextKey = &contextType{name: "match-observer"}
+)
 
 func contextWithVars(ctx context.Context, vars Vars) context.Context {
 	return context.WithValue(ctx, varsContextKey, vars)
@@ -18,35 +26,163 @@ func GetVars(ctx context.Context) Vars {
 	return vars
 }
 
+func contextWithNode(ctx context.Context, node *TrieNode) context.Context {
+	return context.WithValue(ctx, nodeContextKey, node)
+}
+
+// GetNode returns the TrieNode matched by the request path, regardless of
+// the request method. It returns nil if no node matches the path.
+func GetNode(ctx context.Context) *TrieNode {
+	node, _ := ctx.Value(nodeContextKey).(*TrieNode)
+	return node
+}
+
+// MatchObserver is called by the Router with the route and vars matched for
+// a request, the route is nil if no route matches.
+type MatchObserver func(route *Route, vars Vars)
+
+// ContextWithMatchObserver returns a copy of ctx with the observer, the
+// Router calls it before the middlewares when it serves a request with the
+// context. It is useful to assert the routing of the served requests in
+// tests.
+func ContextWithMatchObserver(ctx context.Context, observer MatchObserver) context.Context {
+	return context.WithValue(ctx, observerContextKey, observer)
+}
+
+// Middleware wraps a http.Handler with additional behaviour.
+type Middleware func(http.Handler) http.Handler
+
 type Router struct {
-	trie *Trie
+	trie        *Trie
+	hosts       map[string]*Trie
+	middlewares []Middleware
+	handler     http.Handler
 }
 
 func NewRouter() *Router {
-	return &Router{
+	r := &Router{
 		trie: NewTrie(),
 	}
+
+	r.handler = http.HandlerFunc(r.dispatch)
+	return r
 }
 
-func (r *Router) Handle(method string, path string, handler http.Handler) {
-	if err := r.trie.Insert(path, method, handler); err != nil {
-		panic(err)
+// Use appends middlewares to the router. The middlewares are called for
+// every request after the path is matched, so they can see the matched node
+// and route even when the method is not registered (e.g. CORS preflight
+// requests).
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+
+	var handler http.Handler = http.HandlerFunc(r.dispatch)
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
 	}
+
+	r.handler = handler
 }
 
-func (r *Router) HandleFunc(method string, path string, handler http.HandlerFunc) {
-	if err := r.trie.Insert(path, method, handler); err != nil {
+// Handle registers the handler for the given method and path. The opts
+// configure the route, see RouteOption.
+func (r *Router) Handle(method string, path string, handler http.Handler, opts ...RouteOption) {
+	route := newRoute(method, path, handler, opts)
+	if err := r.trie.Insert(path, method, route); err != nil {
 		panic(err)
 	}
 }
 
+func (r *Router) HandleFunc(method string, path string, handler http.HandlerFunc, opts ...RouteOption) {
+	r.Handle(method, path, handler, opts...)
+}
+
+// Match returns the route that ServeHTTP serves for the method, host and
+// path, and the vars captured from the path. The host is ignored if no route
+// is registered for it.
+func (r *Router) Match(method string, host string, path string) (*Route, Vars, bool) {
+	node, vars := r.find(method, host, path, nil)
+	if node == nil {
+		return nil, vars, false
+	}
+
+	route := routeOf(node, method)
+	return route, vars, route != nil
+}
+
+// Routes returns the registered routes sorted by pattern and method, the
+// routes without a host come first.
+func (r *Router) Routes() []*Route {
+	hosts := make([]string, 0, len(r.hosts))
+	for host := range r.hosts {
+		hosts = append(hosts, host)
+	}
+
+	sort.Strings(hosts)
+
+	var routes []*Route
+	collect := func(node *TrieNode) {
+		for _, method := range node.Methods() {
+			if route, ok := node.Value[method].(*Route); ok {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	r.trie.Walk(collect)
+	for _, host := range hosts {
+		r.hosts[host].Walk(collect)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+
+		return routes[i].Pattern < routes[j].Pattern
+	})
+
+	return routes
+}
+
+// ServeHTTP matches the request and calls the middlewares and the route
+// handler. The vars are also set as the request path values, so they can be
+// read using req.PathValue.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	handler, vars, err := r.trie.Get(req.URL.Path, req.Method)
-	if err != nil {
-		http.NotFound(w, req)
+	node, vars := r.lookup(req)
+
+	var route *Route
+	ctx := contextWithVars(req.Context(), vars)
+	ctx = contextWithNode(ctx, node)
+	if node != nil {
+		route = routeOf(node, req.Method)
+		ctx = contextWithRoute(ctx, route)
+	}
+
+	if observe, ok := ctx.Value(observerContextKey).(MatchObserver); ok {
+		observe(route, vars)
+	}
+
+	req = req.WithContext(ctx)
+	for _, v := range vars {
+		req.SetPathValue(v.Name, v.Value)
+	}
+
+	r.handler.ServeHTTP(w, req)
+}
+
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) {
+	route := GetRoute(req.Context())
+	if route != nil {
+		route.ServeHTTP(w, req)
 		return
 	}
 
-	ctx := contextWithVars(req.Context(), vars)
-	handler.ServeHTTP(w, req.WithContext(ctx))
+	node := GetNode(req.Context())
+	if node == nil || len(node.Value) == 0 {
+		writeError(w, req, http.StatusNotFound, "no route matches the path")
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(allowedMethods(node), ", "))
+	writeError(w, req, http.StatusMethodNotAllowed, "the method "+req.Method+" is not allowed")
 }
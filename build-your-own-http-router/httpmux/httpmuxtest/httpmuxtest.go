@@ -0,0 +1,309 @@
+// Package httpmuxtest provides utilities to test the routes of an
+// httpmux.Router without starting a server.
+package httpmuxtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// UpdateEnv is the environment variable that makes ExpectRouteTable rewrite
+// the golden files when it is set to a non-empty value, e.g.
+//
+//	HTTPMUXTEST_UPDATE=1 go test ./...
+const UpdateEnv = "HTTPMUXTEST_UPDATE"
+
+// Client sends requests to the router using httptest.
+type Client struct {
+	t      testing.TB
+	router *httpmux.Router
+	header http.Header
+}
+
+// New creates a Client of the router.
+func New(t testing.TB, router *httpmux.Router) *Client {
+	return &Client{
+		t:      t,
+		router: router,
+		header: make(http.Header),
+	}
+}
+
+// WithHeader returns a copy of the client that sends the header on every
+// request.
+func (c *Client) WithHeader(key string, value string) *Client {
+	cp := *c
+	cp.header = c.header.Clone()
+	cp.header.Set(key, value)
+	return &cp
+}
+
+func (c *Client) Get(path string) *Response {
+	return c.Do(http.MethodGet, path, nil)
+}
+
+func (c *Client) Delete(path string) *Response {
+	return c.Do(http.MethodDelete, path, nil)
+}
+
+// Post sends the body as JSON, unless it is an io.Reader.
+func (c *Client) Post(path string, body interface{}) *Response {
+	return c.Do(http.MethodPost, path, body)
+}
+
+// Put sends the body as JSON, unless it is an io.Reader.
+func (c *Client) Put(path string, body interface{}) *Response {
+	return c.Do(http.MethodPut, path, body)
+}
+
+// Patch sends the body as JSON, unless it is an io.Reader.
+func (c *Client) Patch(path string, body interface{}) *Response {
+	return c.Do(http.MethodPatch, path, body)
+}
+
+// Do sends the request, the body is sent as JSON unless it is nil or an
+// io.Reader.
+func (c *Client) Do(method string, path string, body interface{}) *Response {
+	c.t.Helper()
+
+	var reader io.Reader
+	isJSON := false
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			c.t.Fatalf("httpmuxtest: encode body: %v", err)
+		}
+
+		reader = bytes.NewReader(encoded)
+		isJSON = true
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+
+	if isJSON && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// the route and vars are captured from the served request, so the host
+	// routes and the HEAD fallback are reported as the router sees them.
+	var (
+		route *httpmux.Route
+		vars  httpmux.Vars
+	)
+
+	req = req.WithContext(httpmux.ContextWithMatchObserver(req.Context(), func(r *httpmux.Route, v httpmux.Vars) {
+		route, vars = r, v
+	}))
+
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+
+	return &Response{
+		t:        c.t,
+		desc:     method + " " + path,
+		Recorder: rec,
+		Route:    route,
+		Vars:     vars,
+	}
+}
+
+// Response is the recorded response with fluent assertions. The assertions
+// stop the test on failure.
+type Response struct {
+	t    testing.TB
+	desc string
+
+	Recorder *httptest.ResponseRecorder
+
+	// Route is the matched route, nil if no route matches.
+	Route *httpmux.Route
+
+	// Vars are the vars captured from the path.
+	Vars httpmux.Vars
+}
+
+func (r *Response) fatalf(format string, args ...interface{}) {
+	r.t.Helper()
+	r.t.Fatalf("%s: %s", r.desc, fmt.Sprintf(format, args...))
+}
+
+func (r *Response) ExpectStatus(code int) *Response {
+	r.t.Helper()
+	if r.Recorder.Code != code {
+		r.fatalf("expected status %d; got %d with body %q", code, r.Recorder.Code, r.Recorder.Body.String())
+	}
+
+	return r
+}
+
+func (r *Response) ExpectHeader(key string, value string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != value {
+		r.fatalf("expected header %s is %q; got %q", key, value, got)
+	}
+
+	return r
+}
+
+func (r *Response) ExpectBody(body string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); got != body {
+		r.fatalf("expected body %q; got %q", body, got)
+	}
+
+	return r
+}
+
+// ExpectJSON compares the body with v semantically, so the formatting and
+// the order of the object keys don't matter.
+func (r *Response) ExpectJSON(v interface{}) *Response {
+	r.t.Helper()
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		r.fatalf("encode expected JSON: %v", err)
+	}
+
+	var exp, got interface{}
+	_ = json.Unmarshal(encoded, &exp)
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), &got); err != nil {
+		r.fatalf("expected JSON body; got %q", r.Recorder.Body.String())
+	}
+
+	if !reflect.DeepEqual(exp, got) {
+		r.fatalf("expected JSON %s; got %s", encoded, strings.TrimSpace(r.Recorder.Body.String()))
+	}
+
+	return r
+}
+
+// DecodeJSON decodes the body into v.
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.fatalf("decode JSON body: %v", err)
+	}
+
+	return r
+}
+
+// ExpectPattern asserts the pattern of the matched route.
+func (r *Response) ExpectPattern(pattern string) *Response {
+	r.t.Helper()
+	if r.Route == nil {
+		r.fatalf("expected route %s matches; got no route", pattern)
+	}
+
+	if r.Route.Pattern != pattern {
+		r.fatalf("expected route %s matches; got %s", pattern, r.Route.Pattern)
+	}
+
+	return r
+}
+
+// ExpectNoRoute asserts that no route matches the request.
+func (r *Response) ExpectNoRoute() *Response {
+	r.t.Helper()
+	if r.Route != nil {
+		r.fatalf("expected no route matches; got %s", r.Route.Pattern)
+	}
+
+	return r
+}
+
+// ExpectVars asserts all the vars captured from the path.
+func (r *Response) ExpectVars(vars httpmux.Vars) *Response {
+	r.t.Helper()
+	if len(vars) == 0 && len(r.Vars) == 0 {
+		return r
+	}
+
+	if !reflect.DeepEqual(vars, r.Vars) {
+		r.fatalf("expected vars %+v; got %+v", vars, r.Vars)
+	}
+
+	return r
+}
+
+// ExpectVar asserts a single var captured from the path.
+func (r *Response) ExpectVar(name string, value string) *Response {
+	r.t.Helper()
+	if got := r.Vars.ByName(name); got != value {
+		r.fatalf("expected var %s is %q; got %q", name, value, got)
+	}
+
+	return r
+}
+
+// RouteTable formats the routes of the router, one route per line with the
+// method, the host and the pattern. The routes of any host have "*" as the
+// host.
+func RouteTable(router *httpmux.Router) string {
+	routes := router.Routes()
+
+	width := 1
+	for _, route := range routes {
+		if len(route.Host) > width {
+			width = len(route.Host)
+		}
+	}
+
+	var sb strings.Builder
+	for _, route := range routes {
+		host := route.Host
+		if host == "" {
+			host = "*"
+		}
+
+		fmt.Fprintf(&sb, "%-7s %-*s %s\n", route.Method, width, host, route.Pattern)
+	}
+
+	return sb.String()
+}
+
+// ExpectRouteTable compares the RouteTable with the golden file. Run the
+// test with the UpdateEnv environment variable set to rewrite the golden
+// file.
+func ExpectRouteTable(t testing.TB, router *httpmux.Router, golden string) {
+	t.Helper()
+
+	got := RouteTable(router)
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatalf("httpmuxtest: create golden dir: %v", err)
+		}
+
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatalf("httpmuxtest: write golden file: %v", err)
+		}
+
+		return
+	}
+
+	exp, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("httpmuxtest: read golden file: %v, run the test with %s=1 to create it", err, UpdateEnv)
+	}
+
+	if string(exp) != got {
+		t.Fatalf("httpmuxtest: route table does not match %s\nexpected:\n%s\ngot:\n%s", golden, exp, got)
+	}
+}
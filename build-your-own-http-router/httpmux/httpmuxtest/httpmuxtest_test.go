@@ -0,0 +1,112 @@
+package httpmuxtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+	"github.com/josestg/build-your-own-http-router/httpmux/render"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func newTestRouter() *httpmux.Router {
+	router := httpmux.NewRouter()
+
+	v1 := router.Group("/v1")
+	v1.Handle(http.MethodGet, "/users/{uid}", httpmux.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return render.Render(w, r, http.StatusOK, user{ID: httpmux.GetVars(r.Context()).ByName("uid"), Name: "jose"})
+	}))
+	v1.Handle(http.MethodPost, "/users", httpmux.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		var u user
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			return httpmux.NewProblem(http.StatusBadRequest, err.Error())
+		}
+
+		return render.Render(w, r, http.StatusCreated, u)
+	}))
+	v1.HandleFunc(http.MethodGet, "/users/{uid}/posts/{pid}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Post", httpmux.GetVars(r.Context()).ByName("pid"))
+	})
+	router.HandlePatternFunc("GET admin.example.com/v1/users", func(w http.ResponseWriter, r *http.Request) {})
+
+	return router
+}
+
+func TestClient(t *testing.T) {
+	client := New(t, newTestRouter())
+
+	client.Get("/v1/users/1").
+		ExpectStatus(http.StatusOK).
+		ExpectPattern("/v1/users/{uid}").
+		ExpectVar("uid", "1").
+		ExpectHeader("Content-Type", "application/json; charset=utf-8").
+		ExpectJSON(map[string]string{"name": "jose", "id": "1"})
+
+	client.Post("/v1/users", user{ID: "2", Name: "stg"}).
+		ExpectStatus(http.StatusCreated).
+		ExpectPattern("/v1/users").
+		ExpectVars(nil).
+		ExpectJSON(user{ID: "2", Name: "stg"})
+
+	client.WithHeader("Accept", "text/plain").
+		Get("/v1/users/1/posts/2").
+		ExpectStatus(http.StatusOK).
+		ExpectVars(httpmux.Vars{{Name: "uid", Value: "1"}, {Name: "pid", Value: "2"}}).
+		ExpectHeader("X-Post", "2")
+
+	var problem map[string]interface{}
+	client.Delete("/v1/users/1").
+		ExpectStatus(http.StatusMethodNotAllowed).
+		ExpectNoRoute().
+		DecodeJSON(&problem)
+
+	if problem["status"] != float64(http.StatusMethodNotAllowed) {
+		t.Errorf("expected problem status 405; got %v", problem["status"])
+	}
+}
+
+func TestExpectRouteTable(t *testing.T) {
+	ExpectRouteTable(t, newTestRouter(), "testdata/routes.golden")
+}
+
+func TestClient_ServedRoute(t *testing.T) {
+	router := httpmux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	router.HandlePatternFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandlePatternFunc("GET api.example.com/users/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	client := New(t, router).WithHeader("Authorization", "Bearer token")
+
+	client.Get("http://api.example.com/users/1").
+		ExpectStatus(http.StatusAccepted).
+		ExpectPattern("/users/{uid}").
+		ExpectVar("uid", "1")
+
+	client.Get("/users/2").
+		ExpectStatus(http.StatusOK).
+		ExpectPattern("/users/{id}").
+		ExpectVar("id", "2")
+
+	// the route is reported even when a middleware rejects the request.
+	New(t, router).Get("http://api.example.com/users/3").
+		ExpectStatus(http.StatusUnauthorized).
+		ExpectPattern("/users/{uid}").
+		ExpectVar("uid", "3")
+}
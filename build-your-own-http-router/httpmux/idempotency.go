@@ -0,0 +1,413 @@
+package httpmux
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// IdempotencyRecord is the state of an Idempotency-Key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request that reserved the key.
+	Fingerprint string
+
+	// Completed reports whether the response is stored, the key is in
+	// progress otherwise.
+	Completed bool
+
+	Status int
+
+	// Header has only the headers set by the handler, so the headers set by
+	// the outer middlewares, e.g. X-Request-ID, are not replayed.
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore stores the Idempotency-Key records.
+type IdempotencyStore interface {
+	// Reserve reserves the key for the request with the fingerprint until
+	// the ttl. If the key is already reserved, it returns the existing
+	// record and false.
+	Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error)
+
+	// Get returns the record of the key, or nil if the key is not reserved.
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+
+	// Complete stores the response of the reserved key.
+	Complete(ctx context.Context, key string, record *IdempotencyRecord) error
+
+	// Release removes the reservation, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions configures the Idempotency middleware.
+type IdempotencyOptions struct {
+	// Store stores the records, default is a MemoryIdempotencyStore.
+	Store IdempotencyStore
+
+	// Header is the request header of the key, default is Idempotency-Key.
+	Header string
+
+	// Methods are the methods that honor the key, default is POST and
+	// PATCH.
+	Methods []string
+
+	// Required rejects the requests of the Methods without a key.
+	Required bool
+
+	// TTL is how long a key is remembered, default is 24h.
+	TTL time.Duration
+
+	// Wait is how long a duplicate of a request in progress waits for the
+	// response, zero means the duplicate gets 409 Conflict immediately.
+	Wait time.Duration
+
+	// MaxBodySize is the size of the biggest request body with a key, the
+	// body is buffered to be fingerprinted, so a bigger body is rejected with
+	// 413 Request Entity Too Large. Default is 1 MiB.
+	MaxBodySize int64
+
+	// Key identifies the client, so the clients don't share the keys.
+	// Default is no client separation.
+	Key KeyFunc
+}
+
+// Idempotency creates a middleware that makes the unsafe methods safe to
+// retry using the Idempotency-Key header. The first request with a key is
+// served and its response is stored, the later requests with the same key
+// get the stored response with the Idempotent-Replayed header. A key that is
+// reused by a different request gets 422 Unprocessable Entity, and a
+// duplicate of a request in progress gets 409 Conflict. The keys are scoped
+// by the route, including its host, and the client of the Key. The 5xx responses
+// are not stored, so the request can be retried. If the store fails, the
+// request is rejected with 503 Service Unavailable.
+func Idempotency(opts IdempotencyOptions) Middleware {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+
+	if opts.Methods == nil {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := GetRoute(r.Context())
+			if route == nil || !containsString(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			idempotencyKey := r.Header.Get(opts.Header)
+			if idempotencyKey == "" {
+				if opts.Required {
+					writeError(w, r, http.StatusBadRequest, "the "+opts.Header+" header is required")
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(idempotencyKey) > 255 {
+				writeError(w, r, http.StatusBadRequest, "the "+opts.Header+" header is too long")
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, opts.MaxBodySize+1))
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "the request body can not be read")
+				return
+			}
+
+			if int64(len(body)) > opts.MaxBodySize {
+				writeError(w, r, http.StatusRequestEntityTooLarge, bodyLimitDetail(opts.MaxBodySize))
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			client := ""
+			if opts.Key != nil {
+				client = opts.Key(r)
+			}
+
+			key := route.Method + " " + route.Host + route.Pattern + " " + client + " " + idempotencyKey
+			fingerprint := requestFingerprint(r, body)
+
+			record, reserved, err := reserveIdempotencyKey(r.Context(), opts, key, fingerprint)
+			switch {
+			case err != nil:
+				writeError(w, r, http.StatusServiceUnavailable, "the idempotency store is unavailable")
+				return
+			case !reserved && record.Fingerprint != fingerprint:
+				writeError(w, r, http.StatusUnprocessableEntity, "the "+opts.Header+" is already used by a different request")
+				return
+			case !reserved && !record.Completed:
+				w.Header().Set("Retry-After", "1")
+				writeError(w, r, http.StatusConflict, "a request with the same "+opts.Header+" is in progress")
+				return
+			case !reserved:
+				h := w.Header()
+				for k, v := range record.Header {
+					h[k] = append([]string(nil), v...)
+				}
+
+				h.Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.Status)
+				_, _ = w.Write(record.Body)
+				return
+			}
+
+			tw := &teeWriter{ResponseWriter: w, status: http.StatusOK, before: w.Header().Clone()}
+			completed := false
+			defer func() {
+				// the key is released if the handler panics or fails, a
+				// detached context is used because the request may be canceled.
+				ctx := context.WithoutCancel(r.Context())
+				if !completed {
+					_ = opts.Store.Release(ctx, key)
+				}
+			}()
+
+			next.ServeHTTP(tw, r)
+			if tw.status >= 500 {
+				return
+			}
+
+			err = opts.Store.Complete(context.WithoutCancel(r.Context()), key, &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				Status:      tw.status,
+				Header:      tw.recordedHeader(),
+				Body:        tw.buf.Bytes(),
+			})
+
+			completed = err == nil
+		})
+	}
+}
+
+// reserveIdempotencyKey reserves the key, a duplicate of a request in
+// progress polls the store until the response is stored, the key is
+// released or the opts.Wait is elapsed.
+func reserveIdempotencyKey(ctx context.Context, opts IdempotencyOptions, key string, fingerprint string) (*IdempotencyRecord, bool, error) {
+	deadline := time.Now().Add(opts.Wait)
+	interval := 10 * time.Millisecond
+
+	for {
+		record, reserved, err := opts.Store.Reserve(ctx, key, fingerprint, opts.TTL)
+		if err != nil || reserved || record.Completed || record.Fingerprint != fingerprint {
+			return record, reserved, err
+		}
+
+		for !record.Completed {
+			if time.Now().Add(interval).After(deadline) {
+				return record, false, nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			case <-time.After(interval):
+			}
+
+			if interval < 200*time.Millisecond {
+				interval *= 2
+			}
+
+			current, err := opts.Store.Get(ctx, key)
+			if err != nil {
+				return nil, false, err
+			}
+
+			// the key is released, try to reserve it again.
+			if current == nil {
+				break
+			}
+
+			record = current
+		}
+
+		if record.Completed {
+			return record, false, nil
+		}
+	}
+}
+
+// requestFingerprint identifies the request by the method, the path and the
+// body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method)
+	_, _ = h.Write([]byte{0})
+	_, _ = io.WriteString(h, r.URL.RequestURI())
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// teeWriter writes the response to the client and records it, the recorded
+// header is the difference from the header before the handler is called.
+type teeWriter struct {
+	http.ResponseWriter
+	status      int
+	before      http.Header
+	header      http.Header
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (tw *teeWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+
+	tw.wroteHeader = true
+	tw.status = code
+	tw.header = tw.headerDiff()
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// recordedHeader returns the header set by the handler. If the handler never
+// writes, the header is sent when it returns, so the difference is taken
+// now.
+func (tw *teeWriter) recordedHeader() http.Header {
+	if !tw.wroteHeader {
+		return tw.headerDiff()
+	}
+
+	return tw.header
+}
+
+func (tw *teeWriter) headerDiff() http.Header {
+	diff := make(http.Header)
+	for k, v := range tw.ResponseWriter.Header() {
+		if !slices.Equal(tw.before[k], v) {
+			diff[k] = append([]string(nil), v...)
+		}
+	}
+
+	return diff
+}
+
+func (tw *teeWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+
+	tw.buf.Write(b)
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *teeWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+type idempotencyEntry struct {
+	record    IdempotencyRecord
+	expiresAt time.Time
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries:   make(map[string]*idempotencyEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expiresAt) {
+		record := entry.record
+		return &record, false, nil
+	}
+
+	s.entries[key] = &idempotencyEntry{
+		record:    IdempotencyRecord{Fingerprint: fingerprint},
+		expiresAt: now.Add(ttl),
+	}
+
+	return nil, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !s.now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+
+	record := entry.record
+	return &record, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return errors.New("the idempotency key is not reserved")
+	}
+
+	entry.record = *record
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep removes the expired keys, so the store doesn't grow forever.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
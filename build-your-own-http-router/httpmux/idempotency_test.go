@@ -0,0 +1,199 @@
+package httpmux
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func serveIdempotent(router http.Handler, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotency(t *testing.T) {
+	var created, requests atomic.Int32
+	router := NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-ID", strconv.Itoa(int(requests.Add(1))))
+			w.Header().Set("Content-Type", "text/plain")
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Use(Idempotency(IdempotencyOptions{}))
+	router.HandleFunc(http.MethodPost, "/v1/users", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		id := strconv.Itoa(int(created.Add(1)))
+		w.Header().Set("Location", "/v1/users/"+id)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, id)
+	})
+
+	rec := serveIdempotent(router, "k1", `{"name":"a"}`)
+	ExpectTrue(t, rec.Code == http.StatusCreated && rec.Body.String() == "1")
+	ExpectHeader(t, rec.Header(), "Idempotent-Replayed", "")
+
+	rec = serveIdempotent(router, "k1", `{"name":"a"}`)
+	ExpectTrue(t, rec.Code == http.StatusCreated && rec.Body.String() == "1")
+	ExpectHeader(t, rec.Header(), "Location", "/v1/users/1")
+	ExpectHeader(t, rec.Header(), "Idempotent-Replayed", "true")
+
+	// the headers of the outer middlewares are not replayed, but the
+	// headers overridden by the handler are.
+	ExpectHeader(t, rec.Header(), "X-Request-ID", "2")
+	ExpectHeader(t, rec.Header(), "Content-Type", "application/json")
+	ExpectTrue(t, created.Load() == 1)
+
+	rec = serveIdempotent(router, "k1", `{"name":"b"}`)
+	ExpectTrue(t, rec.Code == http.StatusUnprocessableEntity)
+
+	// the requests without a key are not deduplicated.
+	serveIdempotent(router, "", `{"name":"a"}`)
+	serveIdempotent(router, "", `{"name":"a"}`)
+	ExpectTrue(t, created.Load() == 3)
+
+	// the failed requests can be retried with the same key.
+	rec = serveIdempotent(router, "k2", "fail")
+	ExpectTrue(t, rec.Code == http.StatusInternalServerError)
+	rec = serveIdempotent(router, "k2", "fail")
+	ExpectTrue(t, rec.Code == http.StatusInternalServerError)
+	ExpectHeader(t, rec.Header(), "Idempotent-Replayed", "")
+}
+
+func TestIdempotency_HeaderWithoutWrite(t *testing.T) {
+	router := NewRouter()
+	router.Use(Idempotency(IdempotencyOptions{}))
+	router.HandleFunc(http.MethodPost, "/v1/users", func(w http.ResponseWriter, r *http.Request) {
+		// the handler sets the header but never calls Write or WriteHeader.
+		w.Header().Set("Location", "/v1/users/1")
+	})
+
+	serveIdempotent(router, "k1", "")
+	rec := serveIdempotent(router, "k1", "")
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectHeader(t, rec.Header(), "Location", "/v1/users/1")
+	ExpectHeader(t, rec.Header(), "Idempotent-Replayed", "true")
+}
+
+func TestIdempotency_HostRoutes(t *testing.T) {
+	var created atomic.Int32
+	router := NewRouter()
+	router.Use(Idempotency(IdempotencyOptions{}))
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		router.HandlePatternFunc("POST "+host+"/v1/users", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.Host+" "+strconv.Itoa(int(created.Add(1))))
+		})
+	}
+
+	do := func(host string) string {
+		req := httptest.NewRequest(http.MethodPost, "/v1/users", nil)
+		req.Host = host
+		req.Header.Set("Idempotency-Key", "k1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	// the routes of the different hosts don't share the keys.
+	ExpectTrue(t, do("a.example.com") == "a.example.com 1")
+	ExpectTrue(t, do("b.example.com") == "b.example.com 2")
+	ExpectTrue(t, do("a.example.com") == "a.example.com 1")
+}
+
+func TestIdempotency_Required(t *testing.T) {
+	router := NewRouter()
+	router.Use(Idempotency(IdempotencyOptions{Required: true}))
+	router.HandleFunc(http.MethodPost, "/v1/users", func(w http.ResponseWriter, r *http.Request) {})
+
+	ExpectTrue(t, serveIdempotent(router, "", "").Code == http.StatusBadRequest)
+	ExpectTrue(t, serveIdempotent(router, strings.Repeat("k", 256), "").Code == http.StatusBadRequest)
+	ExpectTrue(t, serveIdempotent(router, "k", "").Code == http.StatusOK)
+}
+
+func TestIdempotency_Concurrent(t *testing.T) {
+	for _, wait := range []time.Duration{0, time.Second} {
+		var calls atomic.Int32
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		router := NewRouter()
+		router.Use(Idempotency(IdempotencyOptions{Wait: wait}))
+		router.HandleFunc(http.MethodPost, "/v1/users", func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveIdempotent(router, "k", "body")
+		}()
+
+		<-started
+
+		var duplicate *httptest.ResponseRecorder
+		if wait == 0 {
+			duplicate = serveIdempotent(router, "k", "body")
+		} else {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				duplicate = serveIdempotent(router, "k", "body")
+			}()
+
+			time.Sleep(30 * time.Millisecond)
+		}
+
+		close(release)
+		wg.Wait()
+
+		ExpectTrue(t, calls.Load() == 1)
+		if wait == 0 {
+			ExpectTrue(t, duplicate.Code == http.StatusConflict)
+			ExpectHeader(t, duplicate.Header(), "Retry-After", "1")
+		} else {
+			ExpectTrue(t, duplicate.Code == http.StatusCreated)
+			ExpectHeader(t, duplicate.Header(), "Idempotent-Replayed", "true")
+		}
+	}
+}
+
+func TestMemoryIdempotencyStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+	now := time.Unix(0, 0)
+	store.now = func() time.Time { return now }
+
+	_, reserved, _ := store.Reserve(ctx, "k", "fp", time.Minute)
+	ExpectTrue(t, reserved)
+
+	record, reserved, _ := store.Reserve(ctx, "k", "fp", time.Minute)
+	ExpectTrue(t, !reserved && record.Fingerprint == "fp" && !record.Completed)
+
+	now = now.Add(time.Minute)
+	_, reserved, _ = store.Reserve(ctx, "k", "fp", time.Minute)
+	ExpectTrue(t, reserved)
+}
@@ -0,0 +1,247 @@
+// Package jwtauth authenticates httpmux routes using JSON Web Tokens decoded
+// by the jwt.DecodeToken.
+package jwtauth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+	"github.com/josestg/implement-your-own-jwt/jwt"
+)
+
+type contextType struct {
+	name string
+}
+
+var claimsContextKey = &contextType{name: "claims"}
+
+// GetClaims returns the claims stored by the Middleware. The C must be the
+// same claims type used by the Middleware.
+func GetClaims[C any](ctx context.Context) (*C, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*C)
+	return claims, ok
+}
+
+// Extractor extracts the raw token from the request, it returns an empty
+// string if the token is not found.
+type Extractor func(r *http.Request) string
+
+// FromHeader extracts a bearer token from the header, e.g. Authorization.
+func FromHeader(name string) Extractor {
+	return func(r *http.Request) string {
+		value := r.Header.Get(name)
+		if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+			return strings.TrimSpace(value[7:])
+		}
+
+		return ""
+	}
+}
+
+// FromCookie extracts the token from the cookie value.
+func FromCookie(name string) Extractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+
+		return cookie.Value
+	}
+}
+
+// FromQuery extracts the token from the query parameter.
+func FromQuery(name string) Extractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// Options configures the Middleware for the claims type C.
+type Options[C any] struct {
+	// Selector selects the verifier by the token header.
+	Selector jwt.VerifierSelector
+
+	// Extractors are tried in order, default is FromHeader("Authorization").
+	Extractors []Extractor
+
+	// Realm is the realm of the WWW-Authenticate header.
+	Realm string
+
+	// Scopes returns the scopes granted by the claims. It is required by the
+	// routes registered with RequireScopes.
+	Scopes func(claims *C) []string
+
+	// Audiences returns the audiences of the claims. It is required by the
+	// routes registered with RequireAudiences.
+	Audiences func(claims *C) []string
+
+	// ErrorLog logs why a token is invalid, the clients only get a fixed
+	// description. Default is the standard logger of the log package.
+	ErrorLog *log.Logger
+}
+
+// invalidTokenDescription is sent instead of the decoding error, so the
+// verifier internals are not exposed to the clients.
+const invalidTokenDescription = "the token is invalid or expired"
+
+type (
+	scopesMetaKey    struct{}
+	audiencesMetaKey struct{}
+)
+
+// RequireScopes requires the claims to have all the scopes.
+func RequireScopes(scopes ...string) httpmux.RouteOption {
+	return httpmux.WithMeta(scopesMetaKey{}, scopes)
+}
+
+// RequireAudiences requires the claims to have at least one of the
+// audiences.
+func RequireAudiences(audiences ...string) httpmux.RouteOption {
+	return httpmux.WithMeta(audiencesMetaKey{}, audiences)
+}
+
+// Middleware creates a middleware that decodes the token into a new C and
+// stores it in the request context, see GetClaims. Requests without a valid
+// token are rejected with 401 Unauthorized, and requests without the
+// required scopes are rejected with 403 Forbidden.
+func Middleware[C any](opts Options[C]) httpmux.Middleware {
+	if opts.Selector == nil {
+		panic("jwtauth: Options.Selector is required")
+	}
+
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = log.Default()
+	}
+
+	if len(opts.Extractors) == 0 {
+		opts.Extractors = []Extractor{FromHeader("Authorization")}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := extract(r, opts.Extractors)
+			if token == "" {
+				unauthorized(w, r, opts.Realm, "", "")
+				return
+			}
+
+			claims := new(C)
+			if err := jwt.DecodeToken(opts.Selector, token, claims); err != nil {
+				opts.ErrorLog.Printf("jwtauth: %s %s: invalid token: %v", r.Method, r.URL.Path, err)
+				unauthorized(w, r, opts.Realm, "invalid_token", invalidTokenDescription)
+				return
+			}
+
+			route := httpmux.GetRoute(r.Context())
+			if route != nil {
+				audiences, _ := route.Meta(audiencesMetaKey{}).([]string)
+				if len(audiences) > 0 && (opts.Audiences == nil || !containsAny(opts.Audiences(claims), audiences)) {
+					unauthorized(w, r, opts.Realm, "invalid_token", "the token audience is not accepted")
+					return
+				}
+
+				scopes, _ := route.Meta(scopesMetaKey{}).([]string)
+				if len(scopes) > 0 && (opts.Scopes == nil || !containsAll(opts.Scopes(claims), scopes)) {
+					forbidden(w, r, opts.Realm, scopes)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// KeyBySubject identifies the client by the claims subject, it can be used
+// as the httpmux.RateLimiterOptions.Key. The rate limiter must be registered
+// after the Middleware.
+func KeyBySubject[C any](subject func(claims *C) string) httpmux.KeyFunc {
+	return func(r *http.Request) string {
+		claims, ok := GetClaims[C](r.Context())
+		if !ok {
+			return ""
+		}
+
+		return subject(claims)
+	}
+}
+
+func extract(r *http.Request, extractors []Extractor) string {
+	for _, extractor := range extractors {
+		if token := extractor(r); token != "" {
+			return token
+		}
+	}
+
+	return ""
+}
+
+// unauthorized responds 401 with the challenge as defined by RFC 6750.
+func unauthorized(w http.ResponseWriter, r *http.Request, realm string, code string, desc string) {
+	params := make([]string, 0, 3)
+	if realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", realm))
+	}
+
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code))
+	}
+
+	if desc != "" {
+		params = append(params, fmt.Sprintf("error_description=%q", desc))
+	}
+
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	httpmux.WriteProblem(w, r, httpmux.NewProblem(http.StatusUnauthorized, desc))
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request, realm string, scopes []string) {
+	params := []string{`error="insufficient_scope"`, fmt.Sprintf("scope=%q", strings.Join(scopes, " "))}
+	if realm != "" {
+		params = append([]string{fmt.Sprintf("realm=%q", realm)}, params...)
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+	httpmux.WriteProblem(w, r, httpmux.NewProblem(http.StatusForbidden, "the token does not have the required scopes"))
+}
+
+func containsAll(have []string, want []string) bool {
+	for _, w := range want {
+		if !contains(have, w) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsAny(have []string, want []string) bool {
+	for _, w := range want {
+		if contains(have, w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,194 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+	"github.com/josestg/implement-your-own-jwt/jwt"
+)
+
+type testClaims struct {
+	jwt.StandardClaims
+	Scope string `json:"scope,omitempty"`
+}
+
+func newTestRouter(t *testing.T) (*httpmux.Router, func(claims testClaims) string) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+
+	const keyID = "kid-example"
+	signer := jwt.NewRS265Signer(keyID, private)
+	selector := func(alg, kid string) (jwt.Verifier, error) {
+		if alg == "RS256" && kid == keyID {
+			return jwt.NewRS256Verifier(&private.PublicKey), nil
+		}
+
+		return nil, errors.New("unknown verifier")
+	}
+
+	auth := Middleware(Options[testClaims]{
+		Selector:   selector,
+		Extractors: []Extractor{FromHeader("Authorization"), FromCookie("token"), FromQuery("access_token")},
+		Realm:      "api",
+		ErrorLog:   log.New(io.Discard, "", 0),
+		Scopes: func(claims *testClaims) []string {
+			return strings.Fields(claims.Scope)
+		},
+		Audiences: func(claims *testClaims) []string {
+			return []string{claims.Audience}
+		},
+	})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := GetClaims[testClaims](r.Context())
+		_, _ = io.WriteString(w, claims.Subject)
+	}
+
+	router := httpmux.NewRouter()
+	v1 := router.Group("/v1", httpmux.WithMiddleware(auth))
+	v1.HandleFunc(http.MethodGet, "/users", handler, RequireScopes("users:read"))
+	v1.HandleFunc(http.MethodGet, "/me", handler, RequireAudiences("web", "mobile"))
+
+	sign := func(claims testClaims) string {
+		token, err := jwt.CreateToken(signer, jwt.Header{}, claims)
+		if err != nil {
+			t.Fatalf("expecting error nil but got %v", err)
+		}
+
+		return token
+	}
+
+	return router, sign
+}
+
+func TestMiddleware(t *testing.T) {
+	router, sign := newTestRouter(t)
+
+	valid := sign(testClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "user-1",
+			Audience:  "web",
+			ExpiresAt: jwt.NewTime(time.Now().Add(time.Hour)),
+		},
+		Scope: "users:read users:write",
+	})
+
+	expired := sign(testClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewTime(time.Now().Add(-time.Hour)),
+		},
+	})
+
+	noScope := sign(testClaims{
+		StandardClaims: jwt.StandardClaims{Subject: "user-2", Audience: "service"},
+	})
+
+	tests := []struct {
+		desc      string
+		path      string
+		setup     func(r *http.Request)
+		status    int
+		challenge string
+	}{
+		{
+			desc:   "bearer header",
+			path:   "/v1/users",
+			setup:  func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+valid) },
+			status: http.StatusOK,
+		},
+		{
+			desc:   "cookie",
+			path:   "/v1/me",
+			setup:  func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: valid}) },
+			status: http.StatusOK,
+		},
+		{
+			desc:   "query",
+			path:   "/v1/users?access_token=" + valid,
+			setup:  func(r *http.Request) {},
+			status: http.StatusOK,
+		},
+		{
+			desc:      "missing token",
+			path:      "/v1/users",
+			setup:     func(r *http.Request) {},
+			status:    http.StatusUnauthorized,
+			challenge: `Bearer realm="api"`,
+		},
+		{
+			desc:      "expired token",
+			path:      "/v1/users",
+			setup:     func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+expired) },
+			status:    http.StatusUnauthorized,
+			challenge: `Bearer realm="api", error="invalid_token", error_description="the token is invalid or expired"`,
+		},
+		{
+			desc:      "insufficient scope",
+			path:      "/v1/users",
+			setup:     func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+noScope) },
+			status:    http.StatusForbidden,
+			challenge: `Bearer realm="api", error="insufficient_scope", scope="users:read"`,
+		},
+		{
+			desc:      "audience not accepted",
+			path:      "/v1/me",
+			setup:     func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+noScope) },
+			status:    http.StatusUnauthorized,
+			challenge: `Bearer realm="api", error="invalid_token", error_description="the token audience is not accepted"`,
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			tt.setup(req)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expecting status %d but got %d", tt.status, rec.Code)
+			}
+
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("expecting challenge %q but got %q", tt.challenge, got)
+			}
+
+			if tt.status == http.StatusOK && rec.Body.String() != "user-1" {
+				t.Errorf("expecting subject user-1 but got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestKeyBySubject(t *testing.T) {
+	key := KeyBySubject(func(claims *testClaims) string { return claims.Subject })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := key(req); got != "" {
+		t.Errorf("expecting empty key but got %q", got)
+	}
+}
+
+func TestMiddleware_SelectorRequired(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expecting a panic without the Selector")
+		}
+	}()
+
+	Middleware(Options[testClaims]{})
+}
@@ -0,0 +1,134 @@
+package httpmux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ProblemContentType is the media type of the Problem.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an error rendered as the problem details defined by RFC 7807.
+type Problem struct {
+	// Type is an URI that identifies the problem type, default is
+	// "about:blank".
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+
+	// Extensions are additional members of the problem details.
+	Extensions map[string]interface{}
+}
+
+// NewProblem creates a Problem titled by the status text.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+
+	return p.Title + ": " + p.Detail
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+
+	m["type"] = p.Type
+	if p.Type == "" {
+		m["type"] = "about:blank"
+	}
+
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+
+	return json.Marshal(m)
+}
+
+// WriteProblem writes the problem as application/problem+json. If the
+// problem has no instance, the instance is the matched route pattern. A
+// problem without a status is written as 500 Internal Server Error.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Status == 0 {
+		cp := *p
+		cp.Status = http.StatusInternalServerError
+		if cp.Title == "" {
+			cp.Title = http.StatusText(cp.Status)
+		}
+
+		p = &cp
+	}
+
+	if p.Instance == "" {
+		if route := GetRoute(r.Context()); route != nil {
+			cp := *p
+			cp.Instance = route.Pattern
+			p = &cp
+		}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", ProblemContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Del("Content-Length")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// writeError writes the error response generated by the router itself.
+func writeError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	WriteProblem(w, r, NewProblem(status, detail))
+}
+
+// ErrorHandlerFunc is a handler that returns an error, the error is
+// rendered using WriteProblem. A *Problem is rendered as is, other errors
+// are rendered as 500 Internal Server Error without exposing the error
+// message.
+type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f ErrorHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w)
+	err := f(rw, r)
+	if err == nil || rw.wroteHeader {
+		return
+	}
+
+	WriteProblem(w, r, problemOf(r, err))
+}
+
+func problemOf(r *http.Request, err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	if body, ok := r.Body.(*maxBytesBody); ok && body.exceeded.Load() {
+		return NewProblem(http.StatusRequestEntityTooLarge, body.detail())
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewProblem(http.StatusServiceUnavailable, timeoutDetail)
+	}
+
+	return NewProblem(http.StatusInternalServerError, "")
+}
@@ -0,0 +1,118 @@
+package httpmux
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+
+	ExpectHeader(t, rec.Header(), "Content-Type", ProblemContentType)
+
+	var m map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&m); err != nil {
+		t.Fatalf("expect error nil; got %v", err)
+	}
+
+	return m
+}
+
+func TestRouter_Problem(t *testing.T) {
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/v1/users", testHandler("GET /v1/users"))
+	router.Handle(http.MethodPost, "/v1/users", testHandler("POST /v1/users"))
+
+	t.Run("not found", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/unknown", nil))
+
+		ExpectTrue(t, rec.Code == http.StatusNotFound)
+		exp := map[string]interface{}{
+			"type":   "about:blank",
+			"title":  "Not Found",
+			"status": float64(404),
+			"detail": "no route matches the path",
+		}
+
+		if got := decodeProblem(t, rec); !reflect.DeepEqual(exp, got) {
+			t.Errorf("expected %+v; got %+v", exp, got)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/v1/users", nil))
+
+		ExpectTrue(t, rec.Code == http.StatusMethodNotAllowed)
+		ExpectHeader(t, rec.Header(), "Allow", "GET, POST")
+		ExpectTrue(t, decodeProblem(t, rec)["title"] == "Method Not Allowed")
+	})
+}
+
+func TestErrorHandlerFunc(t *testing.T) {
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/v1/users/{uid}", ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		switch GetVars(r.Context()).ByName("uid") {
+		case "1":
+			_, _ = io.WriteString(w, "ok")
+			return nil
+		case "2":
+			return &Problem{
+				Type:       "https://example.com/problems/user-not-found",
+				Title:      "User Not Found",
+				Status:     http.StatusNotFound,
+				Extensions: map[string]interface{}{"uid": "2"},
+			}
+		case "4":
+			return &Problem{Detail: "no status"}
+		default:
+			return errors.New("secret database error")
+		}
+	}))
+	router.Handle(http.MethodPost, "/v1/users", ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		_, err := io.ReadAll(r.Body)
+		return err
+	}), WithMaxBodySize(4))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+	ExpectTrue(t, rec.Code == http.StatusOK && rec.Body.String() == "ok")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/2", nil))
+	exp := map[string]interface{}{
+		"type":     "https://example.com/problems/user-not-found",
+		"title":    "User Not Found",
+		"status":   float64(404),
+		"instance": "/v1/users/{uid}",
+		"uid":      "2",
+	}
+
+	if got := decodeProblem(t, rec); !reflect.DeepEqual(exp, got) {
+		t.Errorf("expected %+v; got %+v", exp, got)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/3", nil))
+	ExpectTrue(t, rec.Code == http.StatusInternalServerError)
+	ExpectTrue(t, !strings.Contains(rec.Body.String(), "secret"))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/4", nil))
+	ExpectTrue(t, rec.Code == http.StatusInternalServerError)
+	ExpectTrue(t, decodeProblem(t, rec)["status"] == float64(500))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/users", io.NopCloser(strings.NewReader("12345")))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	ExpectTrue(t, rec.Code == http.StatusRequestEntityTooLarge)
+	ExpectTrue(t, decodeProblem(t, rec)["detail"] == "the request body exceeds the limit of 4 bytes")
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// Upstream is a server in a Pool.
+type Upstream struct {
+	URL *url.URL
+
+	active    atomic.Int64
+	fails     atomic.Int32
+	downUntil atomic.Int64
+}
+
+// Active returns the number of the in-flight requests to the upstream.
+func (u *Upstream) Active() int64 {
+	return u.active.Load()
+}
+
+// Healthy reports whether the upstream can take requests at the time.
+func (u *Upstream) Healthy(now time.Time) bool {
+	return now.UnixNano() >= u.downUntil.Load()
+}
+
+// Balancer picks the upstream for a request. The upstreams are the healthy
+// upstreams that are not tried yet by the request, in the pool order.
+type Balancer interface {
+	Pick(r *http.Request, upstreams []*Upstream) *Upstream
+}
+
+// BalancerFunc is a function that implements the Balancer.
+type BalancerFunc func(r *http.Request, upstreams []*Upstream) *Upstream
+
+func (f BalancerFunc) Pick(r *http.Request, upstreams []*Upstream) *Upstream {
+	return f(r, upstreams)
+}
+
+// RoundRobin picks the upstreams in turn.
+func RoundRobin() Balancer {
+	var next atomic.Uint64
+	return BalancerFunc(func(r *http.Request, upstreams []*Upstream) *Upstream {
+		n := next.Add(1) - 1
+		return upstreams[n%uint64(len(upstreams))]
+	})
+}
+
+// LeastConnections picks the upstream with the fewest in-flight requests,
+// the ties are picked in turn.
+func LeastConnections() Balancer {
+	rr := RoundRobin()
+	return BalancerFunc(func(r *http.Request, upstreams []*Upstream) *Upstream {
+		least := make([]*Upstream, 0, len(upstreams))
+		for _, u := range upstreams {
+			if len(least) > 0 && u.Active() > least[0].Active() {
+				continue
+			}
+
+			if len(least) > 0 && u.Active() < least[0].Active() {
+				least = least[:0]
+			}
+
+			least = append(least, u)
+		}
+
+		return rr.Pick(r, least)
+	})
+}
+
+// ConsistentHash picks the upstream by the key of the request, e.g.
+// httpmux.KeyByVar or httpmux.KeyByHeader, so the same key goes to the same
+// upstream. It uses the rendezvous hashing, only the keys of an unhealthy
+// upstream move to the other upstreams.
+func ConsistentHash(key httpmux.KeyFunc) Balancer {
+	return BalancerFunc(func(r *http.Request, upstreams []*Upstream) *Upstream {
+		k := key(r)
+
+		var best *Upstream
+		var bestScore uint64
+		for _, u := range upstreams {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(u.URL.String()))
+			_, _ = h.Write([]byte{0})
+			_, _ = h.Write([]byte(k))
+
+			if score := mix(h.Sum64()); best == nil || score > bestScore {
+				best, bestScore = u, score
+			}
+		}
+
+		return best
+	})
+}
+
+// mix spreads the bits of the FNV hash, the scores of the upstreams would be
+// ordered by their URL otherwise.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// PoolOptions configures the Pool.
+type PoolOptions struct {
+	// Balancer picks the upstreams, default is RoundRobin.
+	Balancer Balancer
+
+	// MaxFails is the number of consecutive failures, i.e. connection errors
+	// or 502, 503 and 504 responses, that marks the upstream unhealthy.
+	// Default is 3.
+	MaxFails int
+
+	// FailTimeout is how long the unhealthy upstream takes no requests,
+	// default is 10s.
+	FailTimeout time.Duration
+}
+
+// Pool is a group of upstreams with passive health checks: the upstreams are
+// marked unhealthy by the failures of the proxied requests.
+type Pool struct {
+	upstreams []*Upstream
+	opts      PoolOptions
+	now       func() time.Time
+}
+
+// NewPool creates a Pool of the target URLs, e.g. "http://10.0.0.1:8080".
+func NewPool(targets []string, opts PoolOptions) (*Pool, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("proxy: the pool has no targets")
+	}
+
+	if opts.Balancer == nil {
+		opts.Balancer = RoundRobin()
+	}
+
+	if opts.MaxFails <= 0 {
+		opts.MaxFails = 3
+	}
+
+	if opts.FailTimeout <= 0 {
+		opts.FailTimeout = 10 * time.Second
+	}
+
+	upstreams := make([]*Upstream, len(targets))
+	for i, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.New("proxy: the target " + target + " must be an absolute URL")
+		}
+
+		upstreams[i] = &Upstream{URL: u}
+	}
+
+	return &Pool{
+		upstreams: upstreams,
+		opts:      opts,
+		now:       time.Now,
+	}, nil
+}
+
+// Upstreams returns the upstreams in the pool order.
+func (p *Pool) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// pick returns an upstream that is healthy and not tried yet, or nil.
+func (p *Pool) pick(r *http.Request, tried map[*Upstream]bool) *Upstream {
+	now := p.now()
+	available := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if !tried[u] && u.Healthy(now) {
+			available = append(available, u)
+		}
+	}
+
+	if len(available) == 0 {
+		return nil
+	}
+
+	return p.opts.Balancer.Pick(r, available)
+}
+
+func (p *Pool) fail(u *Upstream) {
+	if int(u.fails.Add(1)) >= p.opts.MaxFails {
+		u.fails.Store(0)
+		u.downUntil.Store(p.now().Add(p.opts.FailTimeout).UnixNano())
+	}
+}
+
+func (p *Pool) succeed(u *Upstream) {
+	u.fails.Store(0)
+}
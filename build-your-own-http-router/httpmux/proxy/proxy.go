@@ -0,0 +1,357 @@
+// Package proxy forwards httpmux routes to the upstream pools, it turns the
+// router into an API gateway.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"strings"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// ErrNoUpstream is returned when every upstream is unhealthy or tried.
+var ErrNoUpstream = errors.New("proxy: no upstream is available")
+
+// errRewrite is returned when a var can not be substituted safely in the
+// Rewrite template.
+var errRewrite = errors.New("proxy: the path can not be rewritten")
+
+// rewriteContextKey stores the rewritten path of the request.
+type rewriteContextKey struct{}
+
+// HeaderRules modifies the headers. The Set and Add values of the request
+// headers can use the path vars, e.g. "{uid}".
+type HeaderRules struct {
+	Set    map[string]string
+	Add    map[string]string
+	Remove []string
+}
+
+func (h HeaderRules) apply(header http.Header, vars httpmux.Vars) {
+	for _, name := range h.Remove {
+		header.Del(name)
+	}
+
+	for name, value := range h.Set {
+		header.Set(name, expandVars(value, vars))
+	}
+
+	for name, value := range h.Add {
+		header.Add(name, expandVars(value, vars))
+	}
+}
+
+// Options configures the proxy handler.
+type Options struct {
+	Pool *Pool
+
+	// Rewrite is the upstream path template, the {name} and {name...} are
+	// replaced by the path vars, e.g. "/internal/users/{uid}". The request
+	// path is forwarded as is if empty. The path is joined to the path of
+	// the upstream URL. The request is rejected with 400 when a var has a dot
+	// segment or an encoded slash, or the cleaned path escapes the static
+	// prefix of the template, e.g. "{rest...}" with "../admin".
+	Rewrite string
+
+	// Retries is the number of the other upstreams tried when an idempotent
+	// request fails. The body of the retried request is buffered.
+	Retries int
+
+	// PreserveHost forwards the Host header of the client instead of the host
+	// of the upstream.
+	PreserveHost bool
+
+	RequestHeaders  HeaderRules
+	ResponseHeaders HeaderRules
+
+	// Transport sends the upstream requests, default is
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// New creates a handler that forwards the requests to the pool. The proxy
+// adds the X-Forwarded-* headers, and the errors are written as problems:
+// 503 when no upstream is available and 502 when the upstream fails.
+func New(opts Options) http.Handler {
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+
+	p := &proxy{opts: opts}
+	p.rp = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		Transport:      &retryTransport{opts: &p.opts},
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+	}
+
+	return p
+}
+
+type proxy struct {
+	opts Options
+	rp   *httputil.ReverseProxy
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.opts.Retries > 0 && idempotent(r.Method) && r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			httpmux.WriteProblem(w, r, httpmux.NewProblem(http.StatusBadRequest, "the request body can not be read"))
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	if p.opts.Rewrite != "" {
+		path, err := rewritePath(p.opts.Rewrite, httpmux.GetVars(r.Context()))
+		if err != nil {
+			httpmux.WriteProblem(w, r, httpmux.NewProblem(http.StatusBadRequest, "the path can not be forwarded"))
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), rewriteContextKey{}, path))
+	}
+
+	p.rp.ServeHTTP(w, r)
+}
+
+func (p *proxy) rewrite(pr *httputil.ProxyRequest) {
+	vars := httpmux.GetVars(pr.In.Context())
+	if path, ok := pr.In.Context().Value(rewriteContextKey{}).(string); ok {
+		pr.Out.URL.Path = path
+		pr.Out.URL.RawPath = ""
+	}
+
+	pr.SetXForwarded()
+	if !p.opts.PreserveHost {
+		pr.Out.Host = ""
+	}
+
+	p.opts.RequestHeaders.apply(pr.Out.Header, vars)
+}
+
+func (p *proxy) modifyResponse(res *http.Response) error {
+	p.opts.ResponseHeaders.apply(res.Header, nil)
+	return nil
+}
+
+func (p *proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNoUpstream) {
+		httpmux.WriteProblem(w, r, httpmux.NewProblem(http.StatusServiceUnavailable, "no upstream is available"))
+		return
+	}
+
+	if r.Context().Err() != nil {
+		return
+	}
+
+	httpmux.WriteProblem(w, r, httpmux.NewProblem(http.StatusBadGateway, "the upstream failed"))
+}
+
+// retryTransport sends the request to the upstreams picked by the pool, and
+// tries the other upstreams if an idempotent request fails.
+type retryTransport struct {
+	opts *Options
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if idempotent(req.Method) {
+		attempts += t.opts.Retries
+	}
+
+	pool := t.opts.Pool
+	tried := make(map[*Upstream]bool)
+	err := ErrNoUpstream
+
+	// last is the failed response, it is returned if no other upstream
+	// can be tried.
+	var last *http.Response
+
+	for i := 0; i < attempts; i++ {
+		upstream := pool.pick(req, tried)
+		if upstream == nil {
+			break
+		}
+
+		if last != nil {
+			_, _ = io.Copy(io.Discard, last.Body)
+			_ = last.Body.Close()
+			last = nil
+		}
+
+		tried[upstream] = true
+		out, outErr := upstreamRequest(req, upstream, i > 0)
+		if outErr != nil {
+			return nil, outErr
+		}
+
+		upstream.active.Add(1)
+		res, resErr := t.opts.Transport.RoundTrip(out)
+		if resErr != nil {
+			upstream.active.Add(-1)
+			if req.Context().Err() != nil {
+				return nil, resErr
+			}
+
+			pool.fail(upstream)
+			err = resErr
+			continue
+		}
+
+		res.Body = &releaseBody{ReadCloser: res.Body, upstream: upstream}
+		if !failed(res.StatusCode) {
+			pool.succeed(upstream)
+			return res, nil
+		}
+
+		pool.fail(upstream)
+		last = res
+	}
+
+	if last != nil {
+		return last, nil
+	}
+
+	return nil, err
+}
+
+// upstreamRequest points the request to the upstream, the body is renewed
+// when the request is retried.
+func upstreamRequest(req *http.Request, upstream *Upstream, retry bool) (*http.Request, error) {
+	out := req.Clone(req.Context())
+	if retry && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		out.Body = body
+	}
+
+	out.URL.Scheme = upstream.URL.Scheme
+	out.URL.Host = upstream.URL.Host
+	out.URL.Path = joinPath(upstream.URL.Path, out.URL.Path)
+	out.URL.RawPath = ""
+	return out, nil
+}
+
+// releaseBody decreases the in-flight requests of the upstream when the
+// response body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	upstream *Upstream
+	released bool
+}
+
+func (b *releaseBody) Close() error {
+	if !b.released {
+		b.released = true
+		b.upstream.active.Add(-1)
+	}
+
+	return b.ReadCloser.Close()
+}
+
+// Write supports the protocol switch, e.g. WebSocket, the ReverseProxy
+// writes to the upstream through the response body.
+func (b *releaseBody) Write(p []byte) (int, error) {
+	w, ok := b.ReadCloser.(io.Writer)
+	if !ok {
+		return 0, errors.New("proxy: the upstream body is not writable")
+	}
+
+	return w.Write(p)
+}
+
+func failed(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func expandVars(template string, vars httpmux.Vars) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	for _, v := range vars {
+		template = strings.ReplaceAll(template, "{"+v.Name+"...}", v.Value)
+		template = strings.ReplaceAll(template, "{"+v.Name+"}", v.Value)
+	}
+
+	return template
+}
+
+// rewritePath expands the template with the vars used by it, and cleans the
+// result. It fails if a var has a dot segment or an encoded slash, or the
+// result is not under the static prefix of the template, i.e. the path up to
+// the last slash before the first var.
+func rewritePath(template string, vars httpmux.Vars) (string, error) {
+	for _, v := range vars {
+		if !strings.Contains(template, "{"+v.Name+"}") && !strings.Contains(template, "{"+v.Name+"...}") {
+			continue
+		}
+
+		value := strings.ToLower(v.Value)
+		if strings.Contains(value, "%2f") || strings.Contains(value, "%5c") || strings.Contains(value, "\\") {
+			return "", errRewrite
+		}
+
+		for _, segment := range strings.Split(value, "/") {
+			if segment == "." || segment == ".." {
+				return "", errRewrite
+			}
+		}
+	}
+
+	expanded := expandVars(template, vars)
+	cleaned := path.Clean(expanded)
+	if strings.HasSuffix(expanded, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	prefix := template
+	if i := strings.Index(template, "{"); i >= 0 {
+		prefix = template[:strings.LastIndex(template[:i], "/")+1]
+	}
+
+	if base := path.Clean("/" + prefix); base != "/" && cleaned != base && !strings.HasPrefix(cleaned, base+"/") {
+		return "", errRewrite
+	}
+
+	return cleaned, nil
+}
+
+func joinPath(base string, path string) string {
+	switch {
+	case base == "" || base == "/":
+		return path
+	case path == "" || path == "/":
+		return base
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// upstream is a test server that counts its requests.
+type upstream struct {
+	*httptest.Server
+	hits atomic.Int32
+}
+
+func newUpstream(t *testing.T, name string, status int) *upstream {
+	u := &upstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.hits.Add(1)
+		w.Header().Set("Server", name)
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Host", r.Host)
+		w.Header().Set("X-User", r.Header.Get("X-User"))
+		w.Header().Set("X-Secret", r.Header.Get("X-Secret"))
+		w.Header().Set("X-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.WriteHeader(status)
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+
+	t.Cleanup(u.Close)
+	return u
+}
+
+func newTestPool(t *testing.T, opts PoolOptions, upstreams ...*upstream) *Pool {
+	targets := make([]string, len(upstreams))
+	for i, u := range upstreams {
+		targets[i] = u.URL
+	}
+
+	pool, err := NewPool(targets, opts)
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	return pool
+}
+
+func serve(router http.Handler, method string, path string, body io.Reader) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, body))
+	return rec
+}
+
+func TestProxy_RewriteAndHeaders(t *testing.T) {
+	a := newUpstream(t, "a", http.StatusOK)
+	b := newUpstream(t, "b", http.StatusOK)
+
+	router := httpmux.NewRouter()
+	router.Handle(http.MethodGet, "/api/users/{uid}/{rest...}", New(Options{
+		Pool:    newTestPool(t, PoolOptions{}, a, b),
+		Rewrite: "/internal/users/{uid}/{rest...}",
+		RequestHeaders: HeaderRules{
+			Set:    map[string]string{"X-User": "user-{uid}"},
+			Remove: []string{"X-Secret"},
+		},
+		ResponseHeaders: HeaderRules{
+			Set:    map[string]string{"X-Gateway": "httpmux"},
+			Remove: []string{"Server"},
+		},
+	}))
+
+	var served []string
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/7/posts/1?draft=true", nil)
+		req.Header.Set("X-Secret", "token")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200; got %d %s", rec.Code, rec.Body.String())
+		}
+
+		h := rec.Header()
+		if h.Get("X-Path") != "/internal/users/7/posts/1" || h.Get("X-User") != "user-7" || h.Get("X-Secret") != "" {
+			t.Fatalf("unexpected upstream request: %v", h)
+		}
+
+		if h.Get("X-Gateway") != "httpmux" || h.Get("Server") != "" || h.Get("X-Forwarded-For") == "" {
+			t.Fatalf("unexpected response headers: %v", h)
+		}
+
+		if h.Get("X-Host") == "example.com" {
+			t.Fatalf("expected the upstream host; got %s", h.Get("X-Host"))
+		}
+
+		served = append(served, h.Get("X-Upstream"))
+	}
+
+	if served[0] == served[1] || served[0] != served[2] || served[1] != served[3] {
+		t.Fatalf("expected round-robin; got %v", served)
+	}
+}
+
+func TestProxy_RetryAndPassiveHealth(t *testing.T) {
+	down := newUpstream(t, "down", http.StatusServiceUnavailable)
+	up := newUpstream(t, "up", http.StatusOK)
+
+	pool := newTestPool(t, PoolOptions{MaxFails: 2, FailTimeout: time.Minute}, down, up)
+	now := time.Unix(0, 0)
+	pool.now = func() time.Time { return now }
+
+	handler := New(Options{Pool: pool, Retries: 1})
+
+	// the non-idempotent request is not retried.
+	rec := serve(handler, http.MethodPost, "/", nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("X-Upstream") != "down" {
+		t.Fatalf("expected 503 from down; got %d %s", rec.Code, rec.Header().Get("X-Upstream"))
+	}
+
+	for i := 0; i < 4; i++ {
+		rec := serve(handler, http.MethodPut, "/", &readerOnce{data: "payload"})
+		if rec.Code != http.StatusOK || rec.Body.String() != "payload" {
+			t.Fatalf("expected 200 payload; got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+
+	if hits := down.hits.Load(); hits != 2 {
+		t.Fatalf("expected down to be skipped after 2 failures; got %d hits", hits)
+	}
+
+	if pool.Upstreams()[0].Healthy(now) {
+		t.Fatal("expected down to be unhealthy")
+	}
+
+	now = now.Add(time.Minute)
+	if !pool.Upstreams()[0].Healthy(now) {
+		t.Fatal("expected down to be healthy after the fail timeout")
+	}
+}
+
+func TestProxy_Unavailable(t *testing.T) {
+	gone := newUpstream(t, "gone", http.StatusOK)
+	gone.Close()
+
+	pool := newTestPool(t, PoolOptions{MaxFails: 1}, gone)
+	handler := New(Options{Pool: pool})
+
+	if rec := serve(handler, http.MethodGet, "/", nil); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502; got %d", rec.Code)
+	}
+
+	rec := serve(handler, http.MethodGet, "/", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503; got %d", rec.Code)
+	}
+
+	if rec.Header().Get("Content-Type") != httpmux.ProblemContentType {
+		t.Fatalf("expected problem; got %s", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	upstreams := make([]*Upstream, 3)
+	for i := range upstreams {
+		upstreams[i] = &Upstream{}
+	}
+
+	upstreams[0].active.Store(2)
+	upstreams[1].active.Store(1)
+	upstreams[2].active.Store(1)
+
+	balancer := LeastConnections()
+	first := balancer.Pick(nil, upstreams)
+	second := balancer.Pick(nil, upstreams)
+	if first == upstreams[0] || second == upstreams[0] || first == second {
+		t.Fatalf("expected the least loaded upstreams in turn")
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	a := newUpstream(t, "a", http.StatusOK)
+	b := newUpstream(t, "b", http.StatusOK)
+	c := newUpstream(t, "c", http.StatusOK)
+
+	router := httpmux.NewRouter()
+	router.Handle(http.MethodGet, "/tenants/{tenant}", New(Options{
+		Pool: newTestPool(t, PoolOptions{Balancer: ConsistentHash(httpmux.KeyByVar("tenant"))}, a, b, c),
+	}))
+
+	assigned := make(map[string]string)
+	for i := 0; i < 30; i++ {
+		tenant := strconv.Itoa(i)
+		assigned[tenant] = serve(router, http.MethodGet, "/tenants/"+tenant, nil).Header().Get("X-Upstream")
+	}
+
+	for tenant, name := range assigned {
+		if got := serve(router, http.MethodGet, "/tenants/"+tenant, nil).Header().Get("X-Upstream"); got != name {
+			t.Fatalf("tenant %s: expected %s; got %s", tenant, name, got)
+		}
+	}
+
+	if a.hits.Load() == 0 || b.hits.Load() == 0 || c.hits.Load() == 0 {
+		t.Fatalf("expected every upstream to get tenants: %d, %d, %d", a.hits.Load(), b.hits.Load(), c.hits.Load())
+	}
+}
+
+// readerOnce is a body that can not be rewound, so the proxy must buffer it
+// to retry the request.
+type readerOnce struct {
+	data string
+	done bool
+}
+
+func (r *readerOnce) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+
+	r.done = true
+	return copy(p, r.data), nil
+}
+
+func TestProxy_RewriteTraversal(t *testing.T) {
+	a := newUpstream(t, "a", http.StatusOK)
+
+	router := httpmux.NewRouter()
+	router.Handle(http.MethodGet, "/api/files/{owner}/{rest...}", New(Options{
+		Pool:    newTestPool(t, PoolOptions{}, a),
+		Rewrite: "/internal/files/{owner}/{rest...}",
+	}))
+
+	tests := []struct {
+		path   string
+		status int
+		origin string
+	}{
+		{path: "/api/files/jose/docs/a.txt", status: http.StatusOK, origin: "/internal/files/jose/docs/a.txt"},
+		{path: "/api/files/jose/..%2e/admin", status: http.StatusOK, origin: "/internal/files/jose/.../admin"},
+		{path: "/api/files/jose/../../admin", status: http.StatusBadRequest},
+		{path: "/api/files/jose/docs/%2e%2e/%2e%2e/%2e%2e/admin", status: http.StatusBadRequest},
+		{path: "/api/files/../x", status: http.StatusBadRequest},
+		{path: "/api/files/jose/a/./b", status: http.StatusBadRequest},
+		{path: "/api/files/jose/a%252f..%252fb", status: http.StatusBadRequest},
+		{path: "/api/files/jose/a%5c..%5cb", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		hits := a.hits.Load()
+		rec := serve(router, http.MethodGet, tt.path, nil)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected %d; got %d", tt.path, tt.status, rec.Code)
+			continue
+		}
+
+		if tt.status != http.StatusOK {
+			if a.hits.Load() != hits {
+				t.Errorf("%s: expected the request is not forwarded", tt.path)
+			}
+
+			continue
+		}
+
+		if got := rec.Header().Get("X-Path"); got != tt.origin {
+			t.Errorf("%s: expected upstream path %s; got %s", tt.path, tt.origin, got)
+		}
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	vars := func(kv ...string) httpmux.Vars {
+		var vars httpmux.Vars
+		for i := 0; i < len(kv); i += 2 {
+			vars = append(vars, httpmux.Var{Name: kv[i], Value: kv[i+1]})
+		}
+
+		return vars
+	}
+
+	tests := []struct {
+		template string
+		vars     httpmux.Vars
+		path     string
+		err      bool
+	}{
+		{template: "/users/{uid}", vars: vars("uid", "1"), path: "/users/1"},
+		{template: "/v2/{rest...}", vars: vars("rest", "a//b/"), path: "/v2/a/b/"},
+		{template: "/{rest...}", vars: vars("rest", "a/b"), path: "/a/b"},
+		{template: "/users/{uid}", vars: vars("uid", "1", "other", ".."), path: "/users/1"},
+		{template: "/users/u-{uid}", vars: vars("uid", "1"), path: "/users/u-1"},
+		{template: "/static", vars: vars("uid", "1"), path: "/static"},
+		{template: "/users/{uid}", vars: vars("uid", ".."), err: true},
+		{template: "/users/{uid}", vars: vars("uid", "%2F"), err: true},
+		{template: "/v2/{rest...}", vars: vars("rest", "a/../../b"), err: true},
+	}
+
+	for _, tt := range tests {
+		path, err := rewritePath(tt.template, tt.vars)
+		if tt.err {
+			if !errors.Is(err, errRewrite) {
+				t.Errorf("%s %v: expected errRewrite; got %q, %v", tt.template, tt.vars, path, err)
+			}
+
+			continue
+		}
+
+		if err != nil || path != tt.path {
+			t.Errorf("%s %v: expected %s; got %q, %v", tt.template, tt.vars, tt.path, path, err)
+		}
+	}
+}
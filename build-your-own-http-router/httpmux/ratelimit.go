@@ -0,0 +1,237 @@
+package httpmux
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket limit. The bucket holds at most Requests
+// tokens and is fully refilled every Period.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+
+	// Key overrides the RateLimiterOptions.Key for the route, e.g.
+	// jwtauth.KeyBySubject limits the authenticated users by the JWT
+	// subject.
+	Key KeyFunc
+}
+
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// RateLimitResult is the state of the bucket after a Take.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+
+	// RetryAfter is the time until the next token is available, it is only
+	// set when the request is not allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore stores the buckets. The MemoryRateLimitStore is suitable
+// for a single instance, multiple instances need an external store.
+type RateLimitStore interface {
+	// Take consumes a token from the bucket identified by key.
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// KeyFunc identifies the client of the request, e.g. KeyByIP, KeyByHeader,
+// KeyByVar, or jwtauth.KeyBySubject for the subject of a JWT.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP identifies the client by the remote address. Put a middleware
+// that rewrites the http.Request.RemoteAddr in front of the router if it
+// runs behind a trusted proxy.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// KeyByHeader identifies the client by the value of a header, e.g. an API
+// key.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByVar identifies the client by a path var, e.g. a tenant id.
+func KeyByVar(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return GetVars(r.Context()).ByName(name)
+	}
+}
+
+type rateLimitMetaKey struct{}
+
+// WithRateLimit declares the rate limit of a route. The limit is enforced by
+// the RateLimiter middleware.
+func WithRateLimit(limit RateLimit) RouteOption {
+	return WithMeta(rateLimitMetaKey{}, limit)
+}
+
+// RateLimiterOptions configures the RateLimiter middleware.
+type RateLimiterOptions struct {
+	// Store is the bucket store, default is NewMemoryRateLimitStore().
+	Store RateLimitStore
+
+	// Key identifies the client, default is KeyByIP. If the key is empty, the
+	// client is identified by KeyByIP.
+	Key KeyFunc
+}
+
+// RateLimiter creates a middleware that enforces the limits declared using
+// WithRateLimit. The buckets are separated per route pattern and per client.
+// If the store fails, the request is allowed.
+func RateLimiter(opts RateLimiterOptions) Middleware {
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore()
+	}
+
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := GetRoute(r.Context())
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limit, ok := route.Meta(rateLimitMetaKey{}).(RateLimit)
+			if !ok || limit.Requests <= 0 || limit.Period <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			keyFunc := opts.Key
+			if limit.Key != nil {
+				keyFunc = limit.Key
+			}
+
+			client := keyFunc(r)
+			if client == "" {
+				client = KeyByIP(r)
+			}
+
+			key := route.Method + " " + route.Host + route.Pattern + " " + client
+			res, err := opts.Store.Take(r.Context(), key, limit)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				retryAfter := strconv.Itoa(ceilSeconds(res.RetryAfter))
+				h.Set("Retry-After", retryAfter)
+				writeError(w, r, http.StatusTooManyRequests, "the rate limit is exceeded, retry after "+retryAfter+" seconds")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// MemoryRateLimitStore is an in-memory RateLimitStore.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	capacity := float64(limit.Requests)
+	rate := limit.rate()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now, period: limit.Period}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := RateLimitResult{
+		Limit: limit.Requests,
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = secondsToDuration((capacity - b.tokens) / rate)
+
+	s.sweep(now)
+	return res, nil
+}
+
+// sweep removes the buckets that have been idle long enough to be full, so
+// the store doesn't grow forever.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
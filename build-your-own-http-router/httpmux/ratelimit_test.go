@@ -0,0 +1,107 @@
+package httpmux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore_Take(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	limit := RateLimit{Requests: 2, Period: 2 * time.Second}
+
+	res, _ := store.Take(context.Background(), "k", limit)
+	ExpectTrue(t, res.Allowed && res.Remaining == 1 && res.Reset == time.Second)
+
+	res, _ = store.Take(context.Background(), "k", limit)
+	ExpectTrue(t, res.Allowed && res.Remaining == 0 && res.Reset == 2*time.Second)
+
+	res, _ = store.Take(context.Background(), "k", limit)
+	ExpectTrue(t, !res.Allowed && res.RetryAfter == time.Second)
+
+	now = now.Add(time.Second)
+	res, _ = store.Take(context.Background(), "k", limit)
+	ExpectTrue(t, res.Allowed)
+
+	res, _ = store.Take(context.Background(), "other", limit)
+	ExpectTrue(t, res.Allowed && res.Remaining == 1)
+}
+
+func TestRateLimiter(t *testing.T) {
+	router := NewRouter()
+	router.Use(RateLimiter(RateLimiterOptions{Key: KeyByHeader("X-Api-Key")}))
+	router.Handle(http.MethodGet, "/v1/users", testHandler("GET /v1/users"), WithRateLimit(RateLimit{Requests: 1, Period: time.Minute}))
+	router.Handle(http.MethodGet, "/v1/users/{uid}", testHandler("GET /v1/users/{uid}"), WithRateLimit(RateLimit{Requests: 1, Period: time.Minute}))
+	router.Handle(http.MethodPost, "/v1/users", testHandler("POST /v1/users"))
+
+	do := func(method string, path string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/v1/users", "a")
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectHeader(t, rec.Header(), "RateLimit-Limit", "1")
+	ExpectHeader(t, rec.Header(), "RateLimit-Remaining", "0")
+
+	rec = do(http.MethodGet, "/v1/users", "a")
+	ExpectTrue(t, rec.Code == http.StatusTooManyRequests)
+	ExpectHeader(t, rec.Header(), "Retry-After", "60")
+
+	// different client.
+	ExpectTrue(t, do(http.MethodGet, "/v1/users", "b").Code == http.StatusOK)
+
+	// same pattern, different vars share the bucket.
+	ExpectTrue(t, do(http.MethodGet, "/v1/users/1", "a").Code == http.StatusOK)
+	ExpectTrue(t, do(http.MethodGet, "/v1/users/2", "a").Code == http.StatusTooManyRequests)
+
+	// route without limit.
+	rec = do(http.MethodPost, "/v1/users", "a")
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectHeader(t, rec.Header(), "RateLimit-Limit", "")
+}
+
+func TestRateLimiter_KeyByVar(t *testing.T) {
+	router := NewRouter()
+	router.Use(RateLimiter(RateLimiterOptions{Key: KeyByVar("tenant")}))
+	router.Handle(http.MethodGet, "/v1/tenants/{tenant}/users", testHandler("GET /v1/tenants/{tenant}/users"), WithRateLimit(RateLimit{Requests: 1, Period: time.Minute}))
+
+	do := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	ExpectTrue(t, do("/v1/tenants/a/users") == http.StatusOK)
+	ExpectTrue(t, do("/v1/tenants/a/users") == http.StatusTooManyRequests)
+	ExpectTrue(t, do("/v1/tenants/b/users") == http.StatusOK)
+}
+
+func TestRateLimiter_HostRoutes(t *testing.T) {
+	router := NewRouter()
+	router.Use(RateLimiter(RateLimiterOptions{}))
+	limit := WithRateLimit(RateLimit{Requests: 1, Period: time.Minute})
+	router.HandlePattern("GET a.example.com/users", testHandler("a"), limit)
+	router.HandlePattern("GET b.example.com/users", testHandler("b"), limit)
+
+	do := func(host string) int {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// the routes of the different hosts have their own buckets.
+	ExpectTrue(t, do("a.example.com") == http.StatusOK)
+	ExpectTrue(t, do("b.example.com") == http.StatusOK)
+	ExpectTrue(t, do("a.example.com") == http.StatusTooManyRequests)
+}
@@ -0,0 +1,253 @@
+// Package render writes handler responses in the media type negotiated from
+// the Accept header.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// Encoder encodes a value into a media type.
+type Encoder interface {
+	// ContentType is the media type without parameters, e.g.
+	// application/json.
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+type JSONEncoder struct{}
+
+func (JSONEncoder) ContentType() string { return "application/json" }
+
+func (JSONEncoder) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+type XMLEncoder struct{}
+
+func (XMLEncoder) ContentType() string { return "application/xml" }
+
+func (XMLEncoder) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// TextEncoder formats the value using fmt.Fprint.
+type TextEncoder struct{}
+
+func (TextEncoder) ContentType() string { return "text/plain" }
+
+func (TextEncoder) Encode(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+// Renderer renders values using the negotiated Encoder.
+type Renderer struct {
+	encoders []Encoder
+}
+
+// New creates a Renderer. The encoders are in the server preference order,
+// the first encoder is used when the request has no Accept header.
+func New(encoders ...Encoder) *Renderer {
+	return &Renderer{encoders: encoders}
+}
+
+// Default renders JSON, XML and plain text.
+var Default = New(JSONEncoder{}, XMLEncoder{}, TextEncoder{})
+
+// Render renders v using the Default renderer.
+func Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	return Default.Render(w, r, status, v)
+}
+
+// Render encodes v using the encoder negotiated from the Accept header and
+// writes it with the status. The value is encoded before the header is
+// written, so the caller can still respond an error if the encoding fails.
+// If no encoder is acceptable, it responds 406 Not Acceptable.
+func (rn *Renderer) Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	w.Header().Add("Vary", "Accept")
+
+	encoder := rn.Negotiate(r)
+	if encoder == nil {
+		httpmux.WriteProblem(w, r, httpmux.NewProblem(http.StatusNotAcceptable, "the supported media types are "+rn.supported()))
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, v); err != nil {
+		return fmt.Errorf("%w: encode %s", err, encoder.ContentType())
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", encoder.ContentType()+"; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Negotiate selects the encoder for the request, or nil if none of the
+// encoders is acceptable.
+func (rn *Renderer) Negotiate(r *http.Request) Encoder {
+	if len(rn.encoders) == 0 {
+		return nil
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return rn.encoders[0]
+	}
+
+	ranges := parseAccept(accept)
+
+	var (
+		best  Encoder
+		bestQ float64
+	)
+
+	for _, encoder := range rn.encoders {
+		if q := quality(ranges, encoder.ContentType()); q > bestQ {
+			best, bestQ = encoder, q
+		}
+	}
+
+	return best
+}
+
+func (rn *Renderer) supported() string {
+	types := make([]string, 0, len(rn.encoders))
+	for _, encoder := range rn.encoders {
+		types = append(types, encoder.ContentType())
+	}
+
+	return strings.Join(types, ", ")
+}
+
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+func (m mediaRange) specificity() int {
+	switch {
+	case m.typ == "*":
+		return 0
+	case m.subtype == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (m mediaRange) match(typ string, subtype string) bool {
+	return (m.typ == "*" || m.typ == typ) && (m.subtype == "*" || m.subtype == subtype)
+}
+
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := splitMediaType(params[0])
+		if !ok {
+			continue
+		}
+
+		m := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				m.q = q
+			}
+		}
+
+		ranges = append(ranges, m)
+	}
+
+	// the most specific range takes precedence.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+
+	return ranges
+}
+
+func quality(ranges []mediaRange, contentType string) float64 {
+	typ, subtype, ok := splitMediaType(contentType)
+	if !ok {
+		return 0
+	}
+
+	for _, m := range ranges {
+		if m.match(typ, subtype) {
+			return m.q
+		}
+	}
+
+	return 0
+}
+
+func splitMediaType(s string) (string, string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	i := strings.IndexByte(s, '/')
+	if i <= 0 || i == len(s)-1 {
+		return "", "", false
+	}
+
+	return s[:i], s[i+1:], true
+}
+
+// NDJSON streams values as newline delimited JSON, each value is flushed to
+// the client as soon as it is encoded.
+type NDJSON struct {
+	w       http.ResponseWriter
+	encoder *json.Encoder
+	flusher http.Flusher
+}
+
+// NewNDJSON writes the header of a application/x-ndjson response.
+func NewNDJSON(w http.ResponseWriter, status int) *NDJSON {
+	h := w.Header()
+	h.Set("Content-Type", "application/x-ndjson")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Del("Content-Length")
+	w.WriteHeader(status)
+
+	flusher, _ := w.(http.Flusher)
+	return &NDJSON{
+		w:       w,
+		encoder: json.NewEncoder(w),
+		flusher: flusher,
+	}
+}
+
+// Encode writes v as a single line.
+func (s *NDJSON) Encode(v interface{}) error {
+	if err := s.encoder.Encode(v); err != nil {
+		return err
+	}
+
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+
+	return nil
+}
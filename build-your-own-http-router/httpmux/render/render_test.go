@@ -0,0 +1,127 @@
+package render
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type user struct {
+	ID   string `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+func (u user) String() string {
+	return u.ID + ":" + u.Name
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			accept:      "",
+			status:      http.StatusCreated,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"id":"1","name":"jose"}` + "\n",
+		},
+		{
+			accept:      "application/xml",
+			status:      http.StatusCreated,
+			contentType: "application/xml; charset=utf-8",
+			body:        `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<user><id>1</id><name>jose</name></user>`,
+		},
+		{
+			accept:      "text/*;q=0.9, application/json;q=0.5",
+			status:      http.StatusCreated,
+			contentType: "text/plain; charset=utf-8",
+			body:        "1:jose",
+		},
+		{
+			accept:      "application/json;q=0, */*",
+			status:      http.StatusCreated,
+			contentType: "application/xml; charset=utf-8",
+			body:        `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<user><id>1</id><name>jose</name></user>`,
+		},
+		{
+			accept:      "image/png",
+			status:      http.StatusNotAcceptable,
+			contentType: "application/problem+json",
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+
+			rec := httptest.NewRecorder()
+			if err := Render(rec, req, http.StatusCreated, user{ID: "1", Name: "jose"}); err != nil {
+				t.Fatalf("expecting error nil but got %v", err)
+			}
+
+			if rec.Code != tt.status {
+				t.Errorf("expecting status %d but got %d", tt.status, rec.Code)
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expecting content type %q but got %q", tt.contentType, got)
+			}
+
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expecting body %q but got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRender_EncodeError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	if err := Render(rec, req, http.StatusOK, make(chan int)); err == nil {
+		t.Fatalf("expecting error non-nil")
+	}
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("expecting nothing is written but got %q", rec.Body.String())
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	stream := NewNDJSON(rec, http.StatusOK)
+	for _, u := range []user{{ID: "1"}, {ID: "2"}} {
+		if err := stream.Encode(u); err != nil {
+			t.Fatalf("expecting error nil but got %v", err)
+		}
+	}
+
+	if !rec.Flushed {
+		t.Errorf("expecting the response is flushed")
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("expecting content type application/x-ndjson but got %q", got)
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var u user
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			t.Fatalf("expecting error nil but got %v", err)
+		}
+		ids = append(ids, u.ID)
+	}
+
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Errorf("expecting ids [1 2] but got %v", ids)
+	}
+}
@@ -0,0 +1,214 @@
+package httpmux
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	requestIDContextKey    = &contextType{name: "request-id"}
+	traceContextContextKey = &contextType{name: "trace-context"}
+)
+
+// ContextWithRequestID returns a copy of ctx with the request ID, it is
+// useful to correlate the work done outside an HTTP request.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// GetRequestID returns the request ID stored by the RequestID middleware.
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// RequestIDOptions configures the RequestID middleware.
+type RequestIDOptions struct {
+	// Header is the request and response header, default is X-Request-ID.
+	Header string
+
+	// Generator generates a new ID when the request doesn't have a valid
+	// one, default is 16 random bytes encoded as hex.
+	Generator func() string
+}
+
+// RequestID creates a middleware that reads the request ID from the request
+// header or generates a new one, stores it in the request context and echoes
+// it on the response.
+func RequestID(opts RequestIDOptions) Middleware {
+	if opts.Header == "" {
+		opts.Header = "X-Request-ID"
+	}
+
+	if opts.Generator == nil {
+		opts.Generator = func() string {
+			return randomHex(16)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(opts.Header)
+			if !validRequestID(id) {
+				id = opts.Generator()
+			}
+
+			w.Header().Set(opts.Header, id)
+			ctx := ContextWithRequestID(r.Context(), id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// validRequestID only accepts short printable ASCII, so the ID can be logged
+// safely.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+var ErrInvalidTraceParent = errors.New("httpmux: invalid traceparent")
+
+// TraceContext is the W3C trace context of a request, as defined by
+// https://www.w3.org/TR/trace-context. The SpanID is zero until a span is
+// started, the TraceContextPropagation middleware only stores the upstream
+// context.
+type TraceContext struct {
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte
+	Flags        byte
+	State        string
+}
+
+// Sampled reports whether the caller may have recorded the trace.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&0x01 == 0x01
+}
+
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// TraceParent formats the traceparent header using the SpanID as the
+// parent-id, so it can be sent to the downstream services.
+func (tc TraceContext) TraceParent() string {
+	return "00-" + tc.TraceIDString() + "-" + tc.SpanIDString() + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// Inject sets the traceparent and tracestate headers, e.g. on the outgoing
+// requests.
+func (tc TraceContext) Inject(h http.Header) {
+	h.Set("traceparent", tc.TraceParent())
+	if tc.State != "" {
+		h.Set("tracestate", tc.State)
+	}
+}
+
+// ParseTraceParent parses the traceparent header. The parent-id of the
+// header is returned as the ParentSpanID.
+func ParseTraceParent(s string) (TraceContext, error) {
+	var tc TraceContext
+
+	// version-format: 00-<32 hex trace-id>-<16 hex parent-id>-<2 hex flags>
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, ErrInvalidTraceParent
+	}
+
+	// future versions may append fields, but version 00 must have exactly 4.
+	if parts[0] == "00" && len(parts) != 4 {
+		return tc, ErrInvalidTraceParent
+	}
+
+	if !decodeLowerHex(tc.TraceID[:], parts[1]) || !decodeLowerHex(tc.ParentSpanID[:], parts[2]) {
+		return tc, ErrInvalidTraceParent
+	}
+
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], parts[3]) {
+		return tc, ErrInvalidTraceParent
+	}
+
+	if tc.TraceID == [16]byte{} || tc.ParentSpanID == [8]byte{} {
+		return tc, ErrInvalidTraceParent
+	}
+
+	tc.Flags = flags[0]
+	return tc, nil
+}
+
+func decodeLowerHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// ContextWithTraceContext returns a copy of ctx with the trace context.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextContextKey, tc)
+}
+
+// GetTraceContext returns the trace context stored by the TraceContextPropagation
+// middleware.
+func GetTraceContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextContextKey).(TraceContext)
+	return tc, ok
+}
+
+// NewTraceContext starts a new sampled trace.
+func NewTraceContext() TraceContext {
+	tc := TraceContext{Flags: 0x01}
+	_, _ = rand.Read(tc.TraceID[:])
+	_, _ = rand.Read(tc.SpanID[:])
+	return tc
+}
+
+// TraceContextPropagation creates a middleware that continues the trace of
+// the traceparent and tracestate headers, or starts a new one. It only
+// stores the upstream context in the request context: the parent-id of the
+// header is the ParentSpanID and the SpanID is left zero. The span ID of the
+// request is minted by the Tracer when the server span starts, and the
+// Tracing middleware writes it on the response traceparent header.
+func TraceContextPropagation() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tc, err := ParseTraceParent(r.Header.Get("traceparent"))
+			if err != nil {
+				tc = TraceContext{Flags: 0x01}
+				_, _ = rand.Read(tc.TraceID[:])
+			} else {
+				tc.State = r.Header.Get("tracestate")
+			}
+
+			ctx := ContextWithTraceContext(r.Context(), tc)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
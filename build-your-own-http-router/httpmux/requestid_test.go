@@ -0,0 +1,103 @@
+package httpmux
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	router := NewRouter()
+	router.Use(RequestID(RequestIDOptions{}))
+	router.HandleFunc(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, GetRequestID(r.Context()))
+	})
+
+	t.Run("propagated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectHeader(t, rec.Header(), "X-Request-ID", "abc-123")
+		ExpectTrue(t, rec.Body.String() == "abc-123")
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-ID", "contains space")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		id := rec.Header().Get("X-Request-ID")
+		ExpectTrue(t, len(id) == 32)
+		ExpectTrue(t, rec.Body.String() == id)
+	})
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true},
+		{value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", valid: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: false},
+		{value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: false},
+		{value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", valid: false},
+		{value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", valid: false},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", valid: false},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", valid: false},
+		{value: "", valid: false},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := ParseTraceParent(tt.value)
+			if (err == nil) != tt.valid {
+				t.Errorf("expecting valid %v but got error %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	var got TraceContext
+
+	router := NewRouter()
+	router.Use(TraceContextPropagation())
+	router.HandleFunc(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetTraceContext(r.Context())
+	})
+
+	t.Run("continues the trace", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("tracestate", "vendor=value")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		ExpectTrue(t, got.TraceIDString() == "4bf92f3577b34da6a3ce929d0e0e4736")
+		ExpectTrue(t, hex.EncodeToString(got.ParentSpanID[:]) == "00f067aa0ba902b7")
+		ExpectTrue(t, got.SpanID == [8]byte{})
+		ExpectTrue(t, got.Sampled())
+		ExpectTrue(t, got.State == "vendor=value")
+		ExpectHeader(t, rec.Header(), "traceparent", "")
+	})
+
+	t.Run("starts a new trace", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		ExpectTrue(t, got.TraceID != [16]byte{})
+		ExpectTrue(t, got.ParentSpanID == [8]byte{})
+		ExpectTrue(t, got.SpanID == [8]byte{})
+		ExpectHeader(t, rec.Header(), "traceparent", "")
+	})
+}
@@ -0,0 +1,181 @@
+package httpmux
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var routeContextKey = &contextType{name: "route"}
+
+func contextWithRoute(ctx context.Context, route *Route) context.Context {
+	return context.WithValue(ctx, routeContextKey, route)
+}
+
+// GetRoute returns the Route matched by the request method and path. It
+// returns nil if there is no matched route.
+func GetRoute(ctx context.Context) *Route {
+	route, _ := ctx.Value(routeContextKey).(*Route)
+	return route
+}
+
+// Route is a handler registered for a method and a path pattern.
+type Route struct {
+	Method  string
+	Pattern string
+	Handler http.Handler
+
+	// Host is the host the route is restricted to, it is only set by
+	// HandlePattern.
+	Host string
+
+	// Name identifies the route, e.g. to invalidate its cached responses.
+	Name string
+
+	timeout     time.Duration
+	maxBodySize int64
+	middlewares []Middleware
+	meta        map[interface{}]interface{}
+
+	// handler is the Handler wrapped by the route options.
+	handler http.Handler
+}
+
+func newRoute(method string, pattern string, handler http.Handler, opts []RouteOption) *Route {
+	route := Route{
+		Method:  method,
+		Pattern: pattern,
+		Handler: handler,
+		meta:    make(map[interface{}]interface{}),
+	}
+
+	for _, opt := range opts {
+		opt(&route)
+	}
+
+	// the first middleware is the outermost.
+	handler = route.Handler
+	for i := len(route.middlewares) - 1; i >= 0; i-- {
+		handler = route.middlewares[i](handler)
+	}
+
+	// the body limit runs inside the timeout, so its 413 is written to the
+	// buffered response before the response is copied out.
+	if route.maxBodySize > 0 {
+		handler = maxBodySizeHandler(handler, route.maxBodySize)
+	}
+
+	if route.timeout > 0 {
+		handler = timeoutHandler(handler, route.timeout)
+	}
+
+	route.handler = handler
+	return &route
+}
+
+func (r *Route) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// Timeout returns the handler deadline, zero means no deadline.
+func (r *Route) Timeout() time.Duration {
+	return r.timeout
+}
+
+// MaxBodySize returns the request body limit in bytes, zero means no limit.
+func (r *Route) MaxBodySize() int64 {
+	return r.maxBodySize
+}
+
+// Meta returns the route metadata associated with the key, or nil.
+func (r *Route) Meta(key interface{}) interface{} {
+	return r.meta[key]
+}
+
+// RouteOption configures a Route at registration time.
+type RouteOption func(*Route)
+
+// WithName names the route.
+func WithName(name string) RouteOption {
+	return func(r *Route) {
+		r.Name = name
+	}
+}
+
+// WithTimeout sets the handler deadline. The deadline is propagated using
+// the request context, and when it is exceeded the client gets
+// 503 Service Unavailable. The response is buffered until the handler
+// returns, so it should not be used for streaming handlers.
+func WithTimeout(d time.Duration) RouteOption {
+	return func(r *Route) {
+		r.timeout = d
+	}
+}
+
+// WithMaxBodySize limits the request body to n bytes. Requests that exceed
+// the limit get 413 Request Entity Too Large.
+func WithMaxBodySize(n int64) RouteOption {
+	return func(r *Route) {
+		r.maxBodySize = n
+	}
+}
+
+// WithMiddleware appends middlewares that only wrap the route handler.
+func WithMiddleware(middlewares ...Middleware) RouteOption {
+	return func(r *Route) {
+		r.middlewares = append(r.middlewares, middlewares...)
+	}
+}
+
+// WithMeta attaches a metadata to the route, it can be read by middlewares
+// using GetRoute(ctx).Meta(key).
+func WithMeta(key interface{}, value interface{}) RouteOption {
+	return func(r *Route) {
+		r.meta[key] = value
+	}
+}
+
+// Group registers routes under the same path prefix and options.
+type Group struct {
+	router *Router
+	prefix string
+	opts   []RouteOption
+}
+
+// Group creates a new route group, the opts are applied to every route in
+// the group before the route's own options.
+func (r *Router) Group(prefix string, opts ...RouteOption) *Group {
+	return &Group{
+		router: r,
+		prefix: prefix,
+		opts:   opts,
+	}
+}
+
+// Group creates a nested group that inherits the prefix and options.
+func (g *Group) Group(prefix string, opts ...RouteOption) *Group {
+	return &Group{
+		router: g.router,
+		prefix: joinPath(g.prefix, prefix),
+		opts:   append(append([]RouteOption{}, g.opts...), opts...),
+	}
+}
+
+func (g *Group) Handle(method string, path string, handler http.Handler, opts ...RouteOption) {
+	g.router.Handle(method, joinPath(g.prefix, path), handler, append(append([]RouteOption{}, g.opts...), opts...)...)
+}
+
+func (g *Group) HandleFunc(method string, path string, handler http.HandlerFunc, opts ...RouteOption) {
+	g.Handle(method, path, handler, opts...)
+}
+
+func joinPath(prefix string, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return prefix
+	}
+
+	return prefix + "/" + path
+}
@@ -0,0 +1,147 @@
+package httpmux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestRouter_Group(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := NewRouter()
+	v1 := router.Group("/v1", WithMiddleware(trace("v1")))
+	users := v1.Group("/users", WithMiddleware(trace("users")))
+	users.HandleFunc(http.MethodGet, "/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		route := GetRoute(r.Context())
+		_, _ = io.WriteString(w, route.Pattern+" "+GetVars(r.Context()).ByName("uid"))
+	}, WithMiddleware(trace("route")))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectTrue(t, rec.Body.String() == "/v1/users/{uid} 1")
+	ExpectTrue(t, strings.Join(calls, ",") == "v1,users,route")
+}
+
+func TestRoute_Timeout(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc(http.MethodGet, "/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		_, _ = io.WriteString(w, "too late")
+	}, WithTimeout(10*time.Millisecond))
+
+	router.HandleFunc(http.MethodGet, "/fast", func(w http.ResponseWriter, r *http.Request) {
+		_, hasDeadline := r.Context().Deadline()
+		ExpectTrue(t, hasDeadline)
+		w.Header().Set("X-Fast", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, "ok")
+	}, WithTimeout(time.Second))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	ExpectTrue(t, rec.Code == http.StatusServiceUnavailable)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	ExpectTrue(t, rec.Code == http.StatusAccepted)
+	ExpectTrue(t, rec.Body.String() == "ok")
+	ExpectHeader(t, rec.Header(), "X-Fast", "yes")
+}
+
+func TestRoute_MaxBodySize(t *testing.T) {
+	router := NewRouter()
+	uploads := router.Group("/uploads", WithMaxBodySize(8))
+	uploads.HandleFunc(http.MethodPost, "/", func(w http.ResponseWriter, r *http.Request) {
+		// doesn't respond the error on purpose, the router must respond 413.
+		b, err := io.ReadAll(r.Body)
+		if err == nil {
+			_, _ = w.Write(b)
+		}
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader("12345678")))
+		ExpectTrue(t, rec.Code == http.StatusOK)
+		ExpectTrue(t, rec.Body.String() == "12345678")
+	})
+
+	t.Run("content length exceeds limit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader("123456789")))
+		ExpectTrue(t, rec.Code == http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("unknown length exceeds limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/uploads", io.NopCloser(strings.NewReader("123456789")))
+		req.ContentLength = -1
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		ExpectTrue(t, rec.Code == http.StatusRequestEntityTooLarge)
+	})
+
+	uploads.HandleFunc(http.MethodPost, "/timed", func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err == nil {
+			_, _ = w.Write(b)
+		}
+	}, WithTimeout(time.Second))
+
+	t.Run("unknown length exceeds limit with timeout", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/uploads/timed", io.NopCloser(strings.NewReader("123456789")))
+		req.ContentLength = -1
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		ExpectTrue(t, rec.Code == http.StatusRequestEntityTooLarge)
+
+		req = httptest.NewRequest(http.MethodPost, "/uploads/timed", io.NopCloser(strings.NewReader("12345678")))
+		req.ContentLength = -1
+
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		ExpectTrue(t, rec.Code == http.StatusOK && rec.Body.String() == "12345678")
+	})
+
+	t.Run("read error at limit", func(t *testing.T) {
+		body := io.MultiReader(strings.NewReader("12345678"), iotest.ErrReader(io.ErrUnexpectedEOF))
+		req := httptest.NewRequest(http.MethodPost, "/uploads", io.NopCloser(body))
+		req.ContentLength = -1
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		ExpectTrue(t, rec.Code == http.StatusOK)
+	})
+}
+
+func TestRoute_Meta(t *testing.T) {
+	type key struct{}
+
+	router := NewRouter()
+	router.HandleFunc(http.MethodGet, "/v1/users", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, GetRoute(r.Context()).Meta(key{}).(string))
+	}, WithMeta(key{}, "users"))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	ExpectTrue(t, rec.Body.String() == "users")
+}
@@ -0,0 +1,79 @@
+package routeconfig
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// Reloader serves the routes of the last valid config. A config is loaded
+// into a new router, so the in-flight requests keep using the old routes and
+// an invalid config never replaces the current one.
+type Reloader struct {
+	reg    *Registry
+	decode DecodeFunc
+
+	// mu serializes the loads, the router is swapped atomically.
+	mu     sync.Mutex
+	router atomic.Pointer[httpmux.Router]
+}
+
+// NewReloader creates a Reloader, the decode is DecodeJSON if nil.
+func NewReloader(reg *Registry, decode DecodeFunc) *Reloader {
+	if decode == nil {
+		decode = DecodeJSON
+	}
+
+	return &Reloader{
+		reg:    reg,
+		decode: decode,
+	}
+}
+
+// Load decodes and validates the config, then replaces the current routes.
+func (r *Reloader) Load(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+
+	router := httpmux.NewRouter()
+	if err := cfg.Apply(router, r.reg); err != nil {
+		return err
+	}
+
+	r.router.Store(router)
+	return nil
+}
+
+// LoadFile loads the config from the file.
+func (r *Reloader) LoadFile(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	return r.Load(data)
+}
+
+// Router returns the router of the current config, or nil if no config is
+// loaded yet.
+func (r *Reloader) Router() *httpmux.Router {
+	return r.router.Load()
+}
+
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	router := r.router.Load()
+	if router == nil {
+		httpmux.WriteProblem(w, req, httpmux.NewProblem(http.StatusServiceUnavailable, "the routes are not loaded"))
+		return
+	}
+
+	router.ServeHTTP(w, req)
+}
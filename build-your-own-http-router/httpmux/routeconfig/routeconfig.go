@@ -0,0 +1,359 @@
+// Package routeconfig registers httpmux routes from a declarative config, the
+// handlers and middlewares are referenced by the names in a Registry.
+package routeconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// Config is the list of routes and the middlewares used by every route.
+type Config struct {
+	Middleware []string      `json:"middleware"`
+	Routes     []RouteConfig `json:"routes"`
+
+	// MiddlewareLine is the line of the middleware list in the config file,
+	// it is used in the validation errors.
+	MiddlewareLine int `json:"-"`
+}
+
+// RouteConfig is a route in the Config. When the Method is empty, the
+// Pattern is a net/http.ServeMux pattern, see httpmux.Router.HandlePattern.
+type RouteConfig struct {
+	Name        string                 `json:"name"`
+	Method      string                 `json:"method"`
+	Pattern     string                 `json:"pattern"`
+	Handler     string                 `json:"handler"`
+	Middleware  []string               `json:"middleware"`
+	Timeout     Duration               `json:"timeout"`
+	MaxBodySize int64                  `json:"max_body_size"`
+	Meta        map[string]interface{} `json:"meta"`
+
+	// Line is the line of the route in the config file, it is used in the
+	// validation errors.
+	Line int `json:"-"`
+}
+
+// Duration is a time.Duration written as a string, e.g. "1.5s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("duration must be a string")
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Error is a config error at a line, the line is zero when it is unknown.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Errors is the list of every error found in the config.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// DecodeFunc decodes a config file, e.g. DecodeJSON or DecodeYAML. The
+// decoders of other formats should set the Line of the routes.
+type DecodeFunc func(data []byte) (*Config, error)
+
+// DecodeJSON decodes a JSON config. The unknown fields are rejected, so the
+// typos are caught before the routes are registered.
+func DecodeJSON(data []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	lineAt := func(offset int64) int {
+		return bytes.Count(data[:offset], []byte("\n")) + 1
+	}
+
+	syntaxError := func(err error) error {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return &Error{Line: lineAt(syntaxErr.Offset), Msg: syntaxErr.Error()}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return &Error{Line: lineAt(int64(len(data))), Msg: "unexpected end of config"}
+		}
+
+		return &Error{Line: lineAt(dec.InputOffset()), Msg: err.Error()}
+	}
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, syntaxError(err)
+	}
+
+	var cfg Config
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, syntaxError(err)
+		}
+
+		key, _ := token.(string)
+		line := lineAt(dec.InputOffset())
+
+		switch key {
+		case "middleware":
+			cfg.MiddlewareLine = line
+			if err := dec.Decode(&cfg.Middleware); err != nil {
+				return nil, &Error{Line: line, Msg: "middleware must be a list of names"}
+			}
+		case "routes":
+			if err := expectDelim(dec, '['); err != nil {
+				return nil, &Error{Line: line, Msg: "routes must be a list"}
+			}
+
+			for dec.More() {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return nil, syntaxError(err)
+				}
+
+				start := dec.InputOffset() - int64(len(raw))
+				route, err := decodeRoute(raw)
+				if err != nil {
+					var typeErr *json.UnmarshalTypeError
+					if errors.As(err, &typeErr) {
+						return nil, &Error{Line: lineAt(start + typeErr.Offset), Msg: err.Error()}
+					}
+
+					return nil, &Error{Line: lineAt(start), Msg: err.Error()}
+				}
+
+				route.Line = lineAt(start)
+				cfg.Routes = append(cfg.Routes, route)
+			}
+
+			if err := expectDelim(dec, ']'); err != nil {
+				return nil, syntaxError(err)
+			}
+		default:
+			return nil, &Error{Line: line, Msg: fmt.Sprintf("unknown field %q", key)}
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, syntaxError(err)
+	}
+
+	return &cfg, nil
+}
+
+func decodeRoute(raw json.RawMessage) (RouteConfig, error) {
+	var route RouteConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&route)
+	return route, err
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %q; got %v", delim, token)
+	}
+
+	return nil
+}
+
+// Registry maps the names used in the config to the handlers and middlewares.
+type Registry struct {
+	handlers    map[string]http.Handler
+	middlewares map[string]httpmux.Middleware
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers:    make(map[string]http.Handler),
+		middlewares: make(map[string]httpmux.Middleware),
+	}
+}
+
+// Handler registers the handler by the name.
+func (r *Registry) Handler(name string, handler http.Handler) *Registry {
+	r.handlers[name] = handler
+	return r
+}
+
+func (r *Registry) HandlerFunc(name string, handler http.HandlerFunc) *Registry {
+	return r.Handler(name, handler)
+}
+
+// Middleware registers the middleware by the name.
+func (r *Registry) Middleware(name string, middleware httpmux.Middleware) *Registry {
+	r.middlewares[name] = middleware
+	return r
+}
+
+// Validate checks every route against the registry and the other routes, it
+// returns Errors that lists every problem found.
+func (c *Config) Validate(reg *Registry) error {
+	var errs Errors
+	for _, name := range c.Middleware {
+		if _, ok := reg.middlewares[name]; !ok {
+			errs = append(errs, &Error{Line: c.MiddlewareLine, Msg: fmt.Sprintf("unknown middleware %q", name)})
+		}
+	}
+
+	// the routes are inserted to the tries to find the conflicts before the
+	// router panics.
+	tries := make(map[string]*httpmux.Trie)
+	for _, route := range c.Routes {
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, &Error{Line: route.Line, Msg: fmt.Sprintf(format, args...)})
+		}
+
+		if route.Handler == "" {
+			fail("handler is required")
+		} else if _, ok := reg.handlers[route.Handler]; !ok {
+			fail("unknown handler %q", route.Handler)
+		}
+
+		for _, name := range route.Middleware {
+			if _, ok := reg.middlewares[name]; !ok {
+				fail("unknown middleware %q", name)
+			}
+		}
+
+		if route.Timeout < 0 {
+			fail("timeout must not be negative")
+		}
+
+		if route.MaxBodySize < 0 {
+			fail("max_body_size must not be negative")
+		}
+
+		method, host, path, err := route.trieKey()
+		if err != nil {
+			fail("%v", err)
+			continue
+		}
+
+		trie, ok := tries[host]
+		if !ok {
+			trie = httpmux.NewTrie()
+			tries[host] = trie
+		}
+
+		if err := trie.Insert(path, method, http.NotFoundHandler()); err != nil {
+			fail("invalid route %s: %v", route.name(), err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// trieKey returns where the route is stored in the router.
+func (r *RouteConfig) trieKey() (method string, host string, path string, err error) {
+	if r.Pattern == "" {
+		return "", "", "", errors.New("pattern is required")
+	}
+
+	if r.Method != "" {
+		if !strings.HasPrefix(r.Pattern, "/") {
+			return "", "", "", fmt.Errorf("pattern %q must start with /", r.Pattern)
+		}
+
+		return r.Method, "", r.Pattern, nil
+	}
+
+	method, host, path, err = httpmux.ParsePattern(r.Pattern)
+	if method == "" {
+		method = httpmux.MethodAny
+	}
+
+	return method, host, path, err
+}
+
+func (r *RouteConfig) name() string {
+	return strings.TrimSpace(r.Method + " " + r.Pattern)
+}
+
+// Apply validates the config and registers the routes to the router. Nothing
+// is registered when the config is invalid.
+func (c *Config) Apply(router *httpmux.Router, reg *Registry) error {
+	if err := c.Validate(reg); err != nil {
+		return err
+	}
+
+	for _, name := range c.Middleware {
+		router.Use(reg.middlewares[name])
+	}
+
+	for _, route := range c.Routes {
+		opts := make([]httpmux.RouteOption, 0, 4+len(route.Meta))
+		if route.Name != "" {
+			opts = append(opts, httpmux.WithName(route.Name))
+		}
+
+		for _, name := range route.Middleware {
+			opts = append(opts, httpmux.WithMiddleware(reg.middlewares[name]))
+		}
+
+		if route.Timeout > 0 {
+			opts = append(opts, httpmux.WithTimeout(time.Duration(route.Timeout)))
+		}
+
+		if route.MaxBodySize > 0 {
+			opts = append(opts, httpmux.WithMaxBodySize(route.MaxBodySize))
+		}
+
+		for key, value := range route.Meta {
+			opts = append(opts, httpmux.WithMeta(key, value))
+		}
+
+		handler := reg.handlers[route.Handler]
+		if route.Method == "" {
+			router.HandlePattern(route.Pattern, handler, opts...)
+		} else {
+			router.Handle(route.Method, route.Pattern, handler, opts...)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package routeconfig
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+const testConfig = `{
+  "middleware": ["server"],
+  "routes": [
+    {
+      "name": "users.get",
+      "method": "GET",
+      "pattern": "/v1/users/{uid}",
+      "handler": "users.get",
+      "middleware": ["audit"],
+      "timeout": "2s",
+      "meta": {"owner": "accounts"}
+    },
+    {
+      "pattern": "POST /v1/users",
+      "handler": "users.create",
+      "max_body_size": 16
+    }
+  ]
+}`
+
+func newTestRegistry(calls *[]string) *Registry {
+	trace := func(name string) httpmux.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				*calls = append(*calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	return NewRegistry().
+		Middleware("server", trace("server")).
+		Middleware("audit", trace("audit")).
+		HandlerFunc("users.get", func(w http.ResponseWriter, r *http.Request) {
+			route := httpmux.GetRoute(r.Context())
+			_, hasDeadline := r.Context().Deadline()
+			if !hasDeadline || route.Timeout() != 2*time.Second {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			_, _ = io.WriteString(w, route.Name+" "+route.Meta("owner").(string)+" "+r.PathValue("uid"))
+		}).
+		HandlerFunc("users.create", func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.ReadAll(r.Body); err == nil {
+				w.WriteHeader(http.StatusCreated)
+			}
+		})
+}
+
+func TestConfig_Apply(t *testing.T) {
+	var calls []string
+	cfg, err := DecodeJSON([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	if cfg.Routes[0].Line != 4 || cfg.Routes[1].Line != 13 || cfg.MiddlewareLine != 2 {
+		t.Fatalf("unexpected lines: %d, %d, %d", cfg.Routes[0].Line, cfg.Routes[1].Line, cfg.MiddlewareLine)
+	}
+
+	router := httpmux.NewRouter()
+	if err := cfg.Apply(router, newTestRegistry(&calls)); err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "users.get accounts 1" {
+		t.Fatalf("expected 200 users.get accounts 1; got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if strings.Join(calls, ",") != "server,audit" {
+		t.Fatalf("expected server,audit; got %v", calls)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(strings.Repeat("x", 32))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413; got %d", rec.Code)
+	}
+}
+
+func TestConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		errs   []string
+	}{
+		{
+			name:   "syntax",
+			config: "{\n  \"routes\": [\n    {\"method\": \"GET\",}\n  ]\n}",
+			errs:   []string{"line 3: "},
+		},
+		{
+			name:   "unknown field",
+			config: "{\n  \"routes\": [\n    {\"method\": \"GET\", \"patern\": \"/\"}\n  ]\n}",
+			errs:   []string{`line 3: json: unknown field "patern"`},
+		},
+		{
+			name:   "type",
+			config: "{\n  \"routes\": [\n    {\n      \"method\": \"GET\",\n      \"max_body_size\": \"1kb\"\n    }\n  ]\n}",
+			errs:   []string{"line 5: "},
+		},
+		{
+			name: "validation",
+			config: `{
+  "middleware": ["missing"],
+  "routes": [
+    {"method": "GET", "pattern": "/a/{id}", "handler": "users.get"},
+    {"method": "GET", "pattern": "/a/{uid}", "handler": "users.get"},
+    {"method": "GET", "pattern": "/b", "handler": "nope", "middleware": ["audit", "nope"]},
+    {"pattern": "GET /c/{x...}/d", "handler": "users.get"},
+    {"method": "GET", "handler": "users.get"}
+  ]
+}`,
+			errs: []string{
+				`line 2: unknown middleware "missing"`,
+				`line 5: invalid route GET /a/{uid}: conflict location`,
+				`line 6: unknown handler "nope"`,
+				`line 6: unknown middleware "nope"`,
+				`line 7: {name...} must be the last segment in pattern GET /c/{x...}/d`,
+				`line 8: pattern is required`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			cfg, err := DecodeJSON([]byte(tt.config))
+			if err == nil {
+				err = cfg.Validate(newTestRegistry(&calls))
+			}
+
+			var errs Errors
+			switch {
+			case errors.As(err, &errs):
+			case err != nil:
+				var configErr *Error
+				if !errors.As(err, &configErr) {
+					t.Fatalf("expected *Error; got %T %v", err, err)
+				}
+				errs = Errors{configErr}
+			}
+
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("expected %d errors; got %v", len(tt.errs), err)
+			}
+
+			for i, exp := range tt.errs {
+				if !strings.HasPrefix(errs[i].Error(), exp) {
+					t.Errorf("expected error %q; got %q", exp, errs[i].Error())
+				}
+			}
+		})
+	}
+}
+
+func TestReloader(t *testing.T) {
+	var calls []string
+	reloader := NewReloader(newTestRegistry(&calls), nil)
+
+	rec := httptest.NewRecorder()
+	reloader.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before the first load; got %d", rec.Code)
+	}
+
+	if err := reloader.Load([]byte(testConfig)); err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	current := reloader.Router()
+	invalid := strings.Replace(testConfig, `"handler": "users.get"`, `"handler": "users.missing"`, 1)
+	if err := reloader.Load([]byte(invalid)); err == nil {
+		t.Fatal("expected the invalid config to be rejected")
+	}
+
+	if reloader.Router() != current {
+		t.Fatal("expected the invalid config to keep the current routes")
+	}
+
+	reloaded := `{"routes": [{"method": "GET", "pattern": "/v2/users/{uid}", "handler": "users.create"}]}`
+	if err := reloader.Load([]byte(reloaded)); err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	reloader.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for the removed route; got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	reloader.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/users/1", nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 from the reloaded route; got %d", rec.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package routeconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeYAML decodes a YAML config, the fields are the same as the JSON
+// config. The document is parsed by gopkg.in/yaml.v3, and the error lines
+// are taken from the parsed nodes.
+func DecodeYAML(data []byte) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, yamlError(err, 0)
+	}
+
+	var cfg Config
+	if len(doc.Content) == 0 {
+		return &cfg, nil
+	}
+
+	root := resolveYAMLAlias(doc.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, &Error{Line: root.Line, Msg: "config must be a mapping"}
+	}
+
+	keys, values, err := yamlMapping(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		value := values[i]
+		line := key.Line
+
+		switch key.Value {
+		case "middleware":
+			cfg.MiddlewareLine = line
+			if value.Kind != yaml.SequenceNode || value.Decode(&cfg.Middleware) != nil {
+				return nil, &Error{Line: line, Msg: "middleware must be a list of names"}
+			}
+		case "routes":
+			if value.Kind != yaml.SequenceNode {
+				return nil, &Error{Line: line, Msg: "routes must be a list"}
+			}
+
+			for _, item := range value.Content {
+				route, err := decodeYAMLRoute(resolveYAMLAlias(item))
+				if err != nil {
+					return nil, err
+				}
+
+				cfg.Routes = append(cfg.Routes, route)
+			}
+		default:
+			return nil, &Error{Line: line, Msg: fmt.Sprintf("unknown field %q", key.Value)}
+		}
+	}
+
+	return &cfg, nil
+}
+
+// decodeYAMLRoute decodes the fields one by one using the JSON decoder, so
+// the field types and errors are the same as the JSON config and the error
+// line is the line of the field.
+func decodeYAMLRoute(node *yaml.Node) (RouteConfig, error) {
+	route := RouteConfig{Line: node.Line}
+	if node.Kind != yaml.MappingNode {
+		return route, &Error{Line: node.Line, Msg: "route must be a mapping"}
+	}
+
+	keys, values, err := yamlMapping(node)
+	if err != nil {
+		return route, err
+	}
+
+	for i, key := range keys {
+		var value interface{}
+		if err := values[i].Decode(&value); err != nil {
+			return route, yamlError(err, key.Line)
+		}
+
+		field, err := json.Marshal(map[string]interface{}{key.Value: value})
+		if err != nil {
+			return route, &Error{Line: key.Line, Msg: err.Error()}
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(field))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&route); err != nil {
+			return route, &Error{Line: key.Line, Msg: err.Error()}
+		}
+	}
+
+	return route, nil
+}
+
+// yamlMapping returns the keys and values of the mapping. The duplicate keys
+// are rejected, yaml.v3 only rejects them when it decodes into a value.
+func yamlMapping(node *yaml.Node) (keys []*yaml.Node, values []*yaml.Node, err error) {
+	seen := make(map[string]bool, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveYAMLAlias(node.Content[i+1])
+		if seen[key.Value] {
+			return nil, nil, &Error{Line: key.Line, Msg: fmt.Sprintf("duplicate key %q", key.Value)}
+		}
+
+		seen[key.Value] = true
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	return keys, values, nil
+}
+
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	return node
+}
+
+// yamlLinePattern matches the line in the yaml.v3 error messages, e.g.
+// "yaml: line 3: mapping values are not allowed in this context".
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlError converts the yaml.v3 error to an *Error, the line is the
+// fallback when the message doesn't have one.
+func yamlError(err error, line int) error {
+	msg := err.Error()
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+	}
+
+	if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		msg = m[2]
+	}
+
+	return &Error{Line: line, Msg: msg}
+}
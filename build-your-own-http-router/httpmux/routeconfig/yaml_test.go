@@ -0,0 +1,160 @@
+package routeconfig
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+const testYAMLConfig = `# the same routes as testConfig.
+middleware: [server]
+routes:
+  - name: users.get
+    method: GET
+    pattern: "/v1/users/{uid}"
+    handler: users.get # the handler name
+    middleware:
+      - audit
+    timeout: 2s
+    meta: {owner: accounts}
+
+  - pattern: POST /v1/users
+    handler: 'users.create'
+    max_body_size: 16
+`
+
+func TestDecodeYAML(t *testing.T) {
+	cfg, err := DecodeYAML([]byte(testYAMLConfig))
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	if cfg.Routes[0].Line != 4 || cfg.Routes[1].Line != 13 || cfg.MiddlewareLine != 2 {
+		t.Fatalf("unexpected lines: %d, %d, %d", cfg.Routes[0].Line, cfg.Routes[1].Line, cfg.MiddlewareLine)
+	}
+
+	exp, _ := DecodeJSON([]byte(testConfig))
+	if !reflect.DeepEqual(cfg, exp) {
+		t.Fatalf("expected the same config as JSON %+v; got %+v", exp, cfg)
+	}
+
+	var calls []string
+	router := httpmux.NewRouter()
+	if err := cfg.Apply(router, newTestRegistry(&calls)); err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "users.get accounts 1" {
+		t.Fatalf("expected 200 users.get accounts 1; got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDecodeYAML_Syntax(t *testing.T) {
+	// the YAML features the hand-written subset used to reject.
+	config := `middleware: &common [server]
+routes:
+  - pattern: >-
+      GET
+      /v1/users/{uid}
+    handler: users.get
+    middleware: *common
+    meta: {
+      owner: accounts
+    }
+`
+
+	cfg, err := DecodeYAML([]byte(config))
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	exp := &Config{
+		Middleware:     []string{"server"},
+		MiddlewareLine: 1,
+		Routes: []RouteConfig{{
+			Line:       3,
+			Pattern:    "GET /v1/users/{uid}",
+			Handler:    "users.get",
+			Middleware: []string{"server"},
+			Meta:       map[string]interface{}{"owner": "accounts"},
+		}},
+	}
+
+	if !reflect.DeepEqual(cfg, exp) {
+		t.Fatalf("expected %+v; got %+v", exp, cfg)
+	}
+
+	cfg, err = DecodeYAML([]byte("# nothing\n"))
+	if err != nil || !reflect.DeepEqual(cfg, &Config{}) {
+		t.Fatalf("expected an empty config; got %+v %v", cfg, err)
+	}
+}
+
+func TestDecodeYAML_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{name: "indentation", config: "routes:\n  - method: GET\n     pattern: /", err: "line 3: mapping values are not allowed in this context"},
+		{name: "tab", config: "routes:\n\t- method: GET", err: "line 2: found character that cannot start any token"},
+		{name: "duplicate key", config: "routes:\n  - method: GET\n    method: POST", err: `line 3: duplicate key "method"`},
+		{name: "duplicate nested key", config: "routes:\n  - method: GET\n\n    meta: {a: 1, a: 2}", err: `line 4: mapping key "a" already defined at line 4`},
+		{name: "unterminated", config: "routes:\n  - pattern: \"/a", err: "line 2: found unexpected end of stream"},
+		{name: "not a mapping", config: "- a", err: "line 1: config must be a mapping"},
+		{name: "unknown config field", config: "middleware: []\nroute: []", err: `line 2: unknown field "route"`},
+		{name: "middleware", config: "middleware: server", err: "line 1: middleware must be a list of names"},
+		{name: "routes", config: "routes: {}", err: "line 1: routes must be a list"},
+		{name: "route", config: "routes:\n  - GET /a", err: "line 2: route must be a mapping"},
+		{name: "unknown field", config: "routes:\n  - method: GET\n    patern: /", err: `line 3: json: unknown field "patern"`},
+		{name: "type", config: "routes:\n  - method: GET\n    max_body_size: 1kb", err: "line 3: json: cannot unmarshal string"},
+		{name: "duration", config: "routes:\n  - method: GET\n\n    timeout: 2", err: "line 4: duration must be a string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeYAML([]byte(tt.config))
+
+			var configErr *Error
+			if !errors.As(err, &configErr) {
+				t.Fatalf("expected *Error; got %T %v", err, err)
+			}
+
+			if !strings.HasPrefix(err.Error(), tt.err) {
+				t.Fatalf("expected error %q; got %q", tt.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestDecodeYAML_Validate(t *testing.T) {
+	config := `routes:
+  - {method: GET, pattern: "/a/{id}", handler: users.get}
+  - {method: GET, pattern: "/a/{uid}", handler: users.get}
+  - method: GET
+    pattern: /b
+    handler: nope
+`
+
+	cfg, err := DecodeYAML([]byte(config))
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	var calls []string
+	var errs Errors
+	if err := cfg.Validate(newTestRegistry(&calls)); !errors.As(err, &errs) {
+		t.Fatalf("expected Errors; got %v", err)
+	}
+
+	if len(errs) != 2 || errs[0].Line != 3 || errs[1].Line != 4 {
+		t.Fatalf("expected the errors at line 3 and 4; got %v", errs)
+	}
+}
@@ -0,0 +1,255 @@
+package httpmux
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// headFallbackMetaKey marks the GET routes registered by HandlePattern, they
+// also serve HEAD requests like the net/http.ServeMux does.
+type headFallbackMetaKey struct{}
+
+// HandlePattern registers the handler for a net/http.ServeMux pattern, so
+// the routes can be moved between the ServeMux and the Router as is. The
+// pattern has the form
+//
+//	[METHOD ][HOST]/[PATH]
+//
+// where the PATH segments can be a {name} wildcard, a {name...} wildcard as
+// the last segment that matches the rest of the path, or {$} as the last
+// segment that only matches the path itself. A PATH that ends with a slash
+// matches every path under it. A pattern without METHOD matches every
+// method, and a GET pattern also matches HEAD.
+//
+// The precedence is the Router's one: a static segment wins over a {name}
+// wildcard, which wins over a {name...} wildcard, and the routes of the
+// request host win over the routes without a host. The trailing slashes are
+// not significant, so "/files/" and "/files/{$}" also match "/files".
+func (r *Router) HandlePattern(pattern string, handler http.Handler, opts ...RouteOption) {
+	method, host, path, err := ParsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	if method == "" {
+		method = MethodAny
+	}
+
+	if method == http.MethodGet {
+		opts = append(opts, WithMeta(headFallbackMetaKey{}, true))
+	}
+
+	route := newRoute(method, patternPath(pattern), handler, opts)
+	route.Host = host
+	if err := r.insert(host, path, method, route); err != nil {
+		panic(err)
+	}
+}
+
+func (r *Router) HandlePatternFunc(pattern string, handler http.HandlerFunc, opts ...RouteOption) {
+	r.HandlePattern(pattern, handler, opts...)
+}
+
+// ParsePattern splits a net/http.ServeMux pattern into the method, the host
+// and the path pattern understood by the Trie. The method and host are empty
+// when the pattern doesn't have them.
+func ParsePattern(pattern string) (method string, host string, path string, err error) {
+	rest := pattern
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		method, rest = rest[:i], strings.TrimLeft(rest[i:], " \t")
+		if method == "" || strings.ContainsAny(method, "/{}") {
+			return "", "", "", errors.New("invalid method in pattern " + pattern)
+		}
+	}
+
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		return "", "", "", errors.New("missing path in pattern " + pattern)
+	}
+
+	host, rest = strings.ToLower(rest[:i]), rest[i:]
+	if strings.ContainsAny(host, "{}") {
+		return "", "", "", errors.New("host wildcards are not supported in pattern " + pattern)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(rest, "/"), "/")
+	names := make(map[string]bool)
+	exact := false
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		switch {
+		case segment == "{$}":
+			if !last {
+				return "", "", "", errors.New("{$} must be the last segment in pattern " + pattern)
+			}
+
+			segments, exact = segments[:i], true
+			continue
+		case !strings.ContainsAny(segment, "{}"):
+			continue
+		case catchAllNameRegex.MatchString(segment) && segment != "{...}":
+			if !last {
+				return "", "", "", errors.New("{name...} must be the last segment in pattern " + pattern)
+			}
+		case !varsNameRegex.MatchString(segment):
+			return "", "", "", errors.New("invalid wildcard " + segment + " in pattern " + pattern)
+		}
+
+		name := strings.TrimSuffix(strings.Trim(segment, "{}"), "...")
+		if names[name] {
+			return "", "", "", errors.New("duplicate wildcard " + name + " in pattern " + pattern)
+		}
+
+		names[name] = true
+	}
+
+	// a path that ends with a slash matches every path under it.
+	if !exact && segments[len(segments)-1] == "" {
+		segments[len(segments)-1] = "{...}"
+	}
+
+	return method, host, "/" + strings.Join(segments, "/"), nil
+}
+
+// patternPath returns the path of the pattern as written, it is used as the
+// Route.Pattern.
+func patternPath(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+
+	return pattern[strings.IndexByte(pattern, '/'):]
+}
+
+// insert adds the route to the trie of the host, the empty host is the
+// default trie.
+func (r *Router) insert(host string, path string, method string, route *Route) error {
+	if host == "" {
+		return r.trie.Insert(path, method, route)
+	}
+
+	if r.hosts == nil {
+		r.hosts = make(map[string]*Trie)
+	}
+
+	trie, ok := r.hosts[host]
+	if !ok {
+		trie = NewTrie()
+		r.hosts[host] = trie
+	}
+
+	return trie.Insert(path, method, route)
+}
+
+// lookup matches the request on the trie of the request host first, then on
+// the default trie. The node of the host is still used when the default trie
+// doesn't match the path, so the client gets 405 instead of 404.
+func (r *Router) lookup(req *http.Request) (*TrieNode, Vars) {
+	return r.find(req.Method, req.Host, req.URL.Path, nil)
+}
+
+// find is the lookup of the method, host and path, the visited tries are
+// added to the explanation if it is not nil.
+func (r *Router) find(method string, host string, path string, explanation *Explanation) (*TrieNode, Vars) {
+	host = hostname(host)
+	trie, ok := r.hosts[host]
+	if !ok {
+		return explainLookup(r.trie, "", path, explanation)
+	}
+
+	hostNode, hostVars := explainLookup(trie, host, path, explanation)
+	if hostNode != nil && routeOf(hostNode, method) != nil {
+		return hostNode, hostVars
+	}
+
+	node, vars := explainLookup(r.trie, "", path, explanation)
+	if node == nil && hostNode != nil {
+		return hostNode, hostVars
+	}
+
+	return node, vars
+}
+
+func explainLookup(trie *Trie, host string, path string, explanation *Explanation) (*TrieNode, Vars) {
+	if explanation == nil {
+		node, vars, _ := trie.Lookup(path)
+		return node, vars
+	}
+
+	steps, node, vars, _ := trie.Explain(path)
+	explanation.Tries = append(explanation.Tries, TrieExplanation{
+		Host:    host,
+		Steps:   steps,
+		Matched: node != nil,
+	})
+
+	return node, vars
+}
+
+// routeOf returns the route of the node for the method, the GET routes
+// registered by HandlePattern also serve HEAD.
+func routeOf(node *TrieNode, method string) *Route {
+	handler, ok := node.Handler(method)
+	if !ok && method == http.MethodHead {
+		handler = node.Value[http.MethodGet]
+		if route, _ := handler.(*Route); route == nil || route.Meta(headFallbackMetaKey{}) == nil {
+			return nil
+		}
+	}
+
+	route, _ := handler.(*Route)
+	return route
+}
+
+// anyMethods are the methods served by a MethodAny route.
+var anyMethods = []string{
+	http.MethodConnect,
+	http.MethodDelete,
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPatch,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodTrace,
+}
+
+// allowedMethods returns the sorted methods of the node for the Allow and
+// Access-Control-Allow-Methods headers, the MethodAny is expanded to the
+// standard methods because "*" is not a method. HEAD is allowed when the GET
+// route also serves it.
+func allowedMethods(node *TrieNode) []string {
+	if _, ok := node.Value[MethodAny]; !ok {
+		methods := node.Methods()
+		if !slices.Contains(methods, http.MethodHead) && routeOf(node, http.MethodHead) != nil {
+			methods = append(methods, http.MethodHead)
+			sort.Strings(methods)
+		}
+
+		return methods
+	}
+
+	methods := append([]string(nil), anyMethods...)
+	for method := range node.Value {
+		if method != MethodAny && !slices.Contains(anyMethods, method) {
+			methods = append(methods, method)
+		}
+	}
+
+	sort.Strings(methods)
+	return methods
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(host)
+}
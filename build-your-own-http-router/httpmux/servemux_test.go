@@ -0,0 +1,176 @@
+package httpmux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		host    string
+		path    string
+		wantErr bool
+	}{
+		{pattern: "GET /v1/users/{uid}", method: "GET", path: "/v1/users/{uid}"},
+		{pattern: "POST\t example.com/items", method: "POST", host: "example.com", path: "/items"},
+		{pattern: "/files/{path...}", path: "/files/{path...}"},
+		{pattern: "/static/", path: "/static/{...}"},
+		{pattern: "/", path: "/{...}"},
+		{pattern: "/{$}", path: "/"},
+		{pattern: "GET /users/{$}", method: "GET", path: "/users"},
+		{pattern: "Example.COM/", host: "example.com", path: "/{...}"},
+		{pattern: "GET", wantErr: true},
+		{pattern: "/a/{b}/{b}", wantErr: true},
+		{pattern: "/a/{path...}/b", wantErr: true},
+		{pattern: "/a/{$}/b", wantErr: true},
+		{pattern: "/a/x{b}", wantErr: true},
+		{pattern: "/a/{...}", wantErr: true},
+		{pattern: "{host}/a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		method, host, path, err := ParsePattern(tt.pattern)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.pattern)
+			}
+			continue
+		}
+
+		ExpectErrNil(t, err)
+		if method != tt.method || host != tt.host || path != tt.path {
+			t.Errorf("%q: expected (%q, %q, %q); got (%q, %q, %q)", tt.pattern, tt.method, tt.host, tt.path, method, host, path)
+		}
+	}
+}
+
+func TestRouter_HandlePattern(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+" "+r.PathValue("uid")+r.PathValue("path"))
+		}
+	}
+
+	router := NewRouter()
+	router.HandlePatternFunc("GET /v1/users/{uid}", echo("user"))
+	router.HandlePatternFunc("DELETE /v1/users/{uid}", echo("delete"))
+	router.HandlePatternFunc("/files/{path...}", echo("files"))
+	router.HandlePatternFunc("GET /static/", echo("static"))
+	router.HandlePatternFunc("GET /{$}", echo("index"))
+	router.HandlePatternFunc("GET api.example.com/v1/users/{uid}", echo("api"))
+	router.HandleFunc(http.MethodGet, "/v2/users/{uid}", echo("native"))
+
+	tests := []struct {
+		method string
+		host   string
+		path   string
+		status int
+		body   string
+	}{
+		{method: http.MethodGet, path: "/v1/users/1", status: http.StatusOK, body: "user 1"},
+		{method: http.MethodHead, path: "/v1/users/1", status: http.StatusOK},
+		{method: http.MethodDelete, path: "/v1/users/1", status: http.StatusOK, body: "delete 1"},
+		{method: http.MethodPost, path: "/v1/users/1", status: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, path: "/files/a/b.txt", status: http.StatusOK, body: "files a/b.txt"},
+		{method: http.MethodGet, path: "/files/", status: http.StatusOK, body: "files "},
+		{method: http.MethodGet, path: "/static/css/main.css", status: http.StatusOK, body: "static "},
+		{method: http.MethodGet, path: "/", status: http.StatusOK, body: "index "},
+		{method: http.MethodGet, path: "/missing", status: http.StatusNotFound},
+		{method: http.MethodGet, host: "api.example.com:8080", path: "/v1/users/2", status: http.StatusOK, body: "api 2"},
+		{method: http.MethodDelete, host: "api.example.com", path: "/v1/users/2", status: http.StatusOK, body: "delete 2"},
+		{method: http.MethodGet, path: "/v2/users/3", status: http.StatusOK, body: "native 3"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s%s: expected status %d; got %d", tt.method, tt.host, tt.path, tt.status, rec.Code)
+			continue
+		}
+
+		if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s %s%s: expected body %q; got %q", tt.method, tt.host, tt.path, tt.body, rec.Body.String())
+		}
+	}
+}
+
+func TestRouter_HandlePatternAllowHead(t *testing.T) {
+	router := NewRouter()
+	router.Use(CORS(CORSOptions{AllowedOrigins: []string{"https://example.com"}}))
+	router.HandlePatternFunc("GET /v1/users/{uid}", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandlePatternFunc("DELETE /v1/users/{uid}", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc(http.MethodGet, "/v2/users/{uid}", func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/users/1", nil))
+	ExpectTrue(t, rec.Code == http.StatusMethodNotAllowed)
+	ExpectHeader(t, rec.Header(), "Allow", "DELETE, GET, HEAD")
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/users/1", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	ExpectHeader(t, rec.Header(), "Access-Control-Allow-Methods", "DELETE, GET, HEAD")
+
+	// the native GET routes don't serve HEAD.
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v2/users/1", nil))
+	ExpectHeader(t, rec.Header(), "Allow", "GET")
+}
+
+func TestRouter_HandlePatternRoutes(t *testing.T) {
+	router := NewRouter()
+	router.HandlePatternFunc("GET example.com/a", func(http.ResponseWriter, *http.Request) {})
+	router.HandlePatternFunc("/b/", func(http.ResponseWriter, *http.Request) {})
+
+	routes := router.Routes()
+	ExpectTrue(t, len(routes) == 2)
+	ExpectTrue(t, routes[0].Method == MethodAny && routes[0].Pattern == "/b/" && routes[0].Host == "")
+	ExpectTrue(t, routes[1].Method == http.MethodGet && routes[1].Pattern == "/a" && routes[1].Host == "example.com")
+}
+
+func TestRouter_Match(t *testing.T) {
+	router := NewRouter()
+	router.HandlePatternFunc("GET /users/{id}", func(http.ResponseWriter, *http.Request) {})
+	router.HandlePatternFunc("GET example.com/users/{uid}", func(http.ResponseWriter, *http.Request) {})
+	router.HandlePatternFunc("/files/", func(http.ResponseWriter, *http.Request) {})
+
+	tests := []struct {
+		method  string
+		host    string
+		path    string
+		pattern string
+		vars    Vars
+	}{
+		{method: http.MethodGet, host: "example.com:8080", path: "/users/1", pattern: "/users/{uid}", vars: Vars{{Name: "uid", Value: "1"}}},
+		{method: http.MethodGet, host: "other.com", path: "/users/1", pattern: "/users/{id}", vars: Vars{{Name: "id", Value: "1"}}},
+		{method: http.MethodHead, host: "", path: "/users/1", pattern: "/users/{id}", vars: Vars{{Name: "id", Value: "1"}}},
+		{method: http.MethodDelete, host: "example.com", path: "/files/", pattern: "/files/"},
+		{method: http.MethodPost, host: "example.com", path: "/users/1"},
+		{method: http.MethodGet, host: "", path: "/unknown"},
+	}
+
+	for _, tt := range tests {
+		route, vars, ok := router.Match(tt.method, tt.host, tt.path)
+		if tt.pattern == "" {
+			ExpectTrue(t, !ok && route == nil)
+			continue
+		}
+
+		ExpectTrue(t, ok && route.Pattern == tt.pattern)
+		ExpectTrue(t, reflect.DeepEqual(vars, tt.vars) || len(vars) == 0 && len(tt.vars) == 0)
+	}
+}
@@ -0,0 +1,287 @@
+package httpmux
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// HealthCheck reports whether a dependency is ready to serve requests.
+type HealthCheck func(ctx context.Context) error
+
+// ServerOptions configures the Server.
+type ServerOptions struct {
+	// Addr is the TCP address to listen on, default is ":8080".
+	Addr string
+
+	// HTTPServer customizes the underlying server, e.g. the timeouts. Its
+	// Handler and ConnState are replaced, and its ConnContext is wrapped.
+	HTTPServer *http.Server
+
+	// Signals trigger the graceful shutdown, default is SIGINT and SIGTERM.
+	Signals []os.Signal
+
+	// DrainDelay is the time between failing the readiness endpoint and
+	// closing the listener, so the load balancer stops sending new requests.
+	DrainDelay time.Duration
+
+	// ShutdownTimeout is the deadline to drain the in-flight requests,
+	// default is 30 seconds.
+	ShutdownTimeout time.Duration
+
+	// CheckTimeout is the deadline of the readiness checks, default is
+	// 5 seconds.
+	CheckTimeout time.Duration
+
+	// TLSConfig serves HTTPS, HTTP/2 is negotiated with ALPN. The config
+	// must have the certificates.
+	TLSConfig *tls.Config
+
+	// H2C accepts cleartext HTTP/2 besides HTTP/1.1, e.g. between the
+	// internal services. The clients either connect with prior knowledge,
+	// which is served by net/http, or upgrade an HTTP/1.1 request with the
+	// Upgrade: h2c header, which is served by golang.org/x/net/http2/h2c.
+	H2C bool
+}
+
+// Server serves a Router with graceful shutdown. It registers GET /healthz
+// for liveness and GET /readyz for readiness on the router.
+type Server struct {
+	router *Router
+	opts   ServerOptions
+	srv    *http.Server
+
+	shuttingDown int32
+	activeConns  int64
+	connIDs      atomic.Uint64
+
+	// upgrades are the connections upgraded to h2c, they are hijacked so the
+	// underlying server doesn't wait for them on shutdown.
+	upgrades sync.WaitGroup
+
+	mu     sync.RWMutex
+	checks map[string]HealthCheck
+}
+
+func NewServer(router *Router, opts ServerOptions) *Server {
+	if opts.Addr == "" {
+		opts.Addr = ":8080"
+	}
+
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 30 * time.Second
+	}
+
+	if opts.CheckTimeout <= 0 {
+		opts.CheckTimeout = 5 * time.Second
+	}
+
+	srv := opts.HTTPServer
+	if srv == nil {
+		srv = &http.Server{ReadHeaderTimeout: 10 * time.Second}
+	}
+
+	s := &Server{
+		router: router,
+		opts:   opts,
+		srv:    srv,
+		checks: make(map[string]HealthCheck),
+	}
+
+	srv.Addr = opts.Addr
+	srv.Handler = http.HandlerFunc(s.serveStream)
+	srv.ConnState = s.trackConn
+	srv.ConnContext = s.connContext(srv.ConnContext)
+
+	if opts.TLSConfig != nil {
+		srv.TLSConfig = opts.TLSConfig
+	}
+
+	if opts.H2C {
+		if srv.Protocols == nil {
+			srv.Protocols = new(http.Protocols)
+			srv.Protocols.SetHTTP1(true)
+			srv.Protocols.SetHTTP2(true)
+		}
+
+		srv.Protocols.SetUnencryptedHTTP2(true)
+		srv.Handler = s.h2cUpgrade(srv.Handler)
+	}
+
+	router.HandleFunc(http.MethodGet, "/healthz", s.healthz)
+	router.HandleFunc(http.MethodGet, "/readyz", s.readyz)
+	return s
+}
+
+// AddReadinessCheck registers a check of /readyz.
+func (s *Server) AddReadinessCheck(name string, check HealthCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checks[name] = check
+}
+
+// ActiveConnections returns the number of open connections.
+func (s *Server) ActiveConnections() int64 {
+	return atomic.LoadInt64(&s.activeConns)
+}
+
+// ListenAndServe listens on the Addr and calls Serve.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, l)
+}
+
+// Serve serves until the ctx is done or one of the Signals is received,
+// then it shuts down gracefully. It serves HTTPS when the server has a
+// TLSConfig. It returns nil after a graceful shutdown.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, s.opts.Signals...)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.srv.TLSConfig != nil {
+			serveErr <- s.srv.ServeTLS(l, "", "")
+			return
+		}
+
+		serveErr <- s.srv.Serve(l)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.DrainDelay+s.opts.ShutdownTimeout)
+	defer cancel()
+
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Shutdown fails the readiness, waits for the DrainDelay, and then drains
+// the in-flight requests and the connections upgraded to h2c until the ctx
+// is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+
+	if s.opts.DrainDelay > 0 {
+		timer := time.NewTimer(s.opts.DrainDelay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	// no upgrade starts after the underlying server is shut down, the
+	// upgrading requests are drained as in-flight requests.
+	upgraded := make(chan struct{})
+	go func() {
+		s.upgrades.Wait()
+		close(upgraded)
+	}()
+
+	select {
+	case <-upgraded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) trackConn(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&s.activeConns, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&s.activeConns, -1)
+	}
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "shutting down"})
+		return
+	}
+
+	s.mu.RLock()
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.opts.CheckTimeout)
+	defer cancel()
+
+	res := healthResponse{Status: "ok", Checks: make(map[string]string, len(names))}
+	status := http.StatusOK
+	for _, name := range names {
+		s.mu.RLock()
+		check := s.checks[name]
+		s.mu.RUnlock()
+
+		if err := check(ctx); err != nil {
+			res.Status = "unavailable"
+			res.Checks[name] = err.Error()
+			status = http.StatusServiceUnavailable
+			continue
+		}
+
+		res.Checks[name] = "ok"
+	}
+
+	writeHealth(w, status, res)
+}
+
+func writeHealth(w http.ResponseWriter, status int, res healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,99 @@
+package httpmux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServer_GracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	router := NewRouter()
+	router.HandleFunc(http.MethodGet, "/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})
+
+	srv := NewServer(router, ServerOptions{DrainDelay: 50 * time.Millisecond, ShutdownTimeout: 5 * time.Second})
+	srv.AddReadinessCheck("db", func(ctx context.Context) error { return nil })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	ExpectErrNil(t, err)
+	baseURL := "http://" + l.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ctx, l)
+	}()
+
+	get := func(path string) (int, string, error) {
+		res, err := http.Get(baseURL + path)
+		if err != nil {
+			return 0, "", err
+		}
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		return res.StatusCode, string(b), err
+	}
+
+	status, body, err := get("/readyz")
+	ExpectErrNil(t, err)
+	ExpectTrue(t, status == http.StatusOK)
+	ExpectTrue(t, body == `{"status":"ok","checks":{"db":"ok"}}`+"\n")
+	ExpectTrue(t, srv.ActiveConnections() > 0)
+
+	slow := make(chan string, 1)
+	go func() {
+		_, body, _ := get("/slow")
+		slow <- body
+	}()
+	<-started
+
+	cancel()
+
+	// the readiness fails during the drain delay, while the liveness is ok.
+	time.Sleep(10 * time.Millisecond)
+	status, _, err = get("/readyz")
+	ExpectErrNil(t, err)
+	ExpectTrue(t, status == http.StatusServiceUnavailable)
+
+	status, _, err = get("/healthz")
+	ExpectErrNil(t, err)
+	ExpectTrue(t, status == http.StatusOK)
+
+	// the in-flight request is drained.
+	close(release)
+	ExpectTrue(t, <-slow == "done")
+	ExpectErrNil(t, <-served)
+}
+
+func TestServer_ReadinessCheckFailed(t *testing.T) {
+	router := NewRouter()
+	srv := NewServer(router, ServerOptions{})
+	srv.AddReadinessCheck("db", func(ctx context.Context) error { return errors.New("connection refused") })
+	srv.AddReadinessCheck("cache", func(ctx context.Context) error { return nil })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	ExpectErrNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.Serve(ctx, l) }()
+
+	res, err := http.Get("http://" + l.Addr().String() + "/readyz")
+	ExpectErrNil(t, err)
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(res.Body)
+	ExpectTrue(t, res.StatusCode == http.StatusServiceUnavailable)
+	ExpectTrue(t, string(b) == `{"status":"unavailable","checks":{"cache":"ok","db":"connection refused"}}`+"\n")
+}
@@ -0,0 +1,187 @@
+// Package sse streams Server-Sent Events from handlers registered on the
+// httpmux.Router, as defined by
+// https://html.spec.whatwg.org/multipage/server-sent-events.html.
+package sse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStreamingUnsupported = errors.New("sse: response writer does not support flushing")
+
+	// ErrInvalidField is returned by Send when the ID or the Event contains
+	// a line terminator, it would inject the other fields otherwise.
+	ErrInvalidField = errors.New("sse: the event id and type must not contain CR or LF")
+)
+
+// Event is a single message of the stream.
+type Event struct {
+	// ID sets the client last event ID, it is sent back using the
+	// Last-Event-ID header when the client reconnects.
+	ID string
+
+	// Event is the event type, the client default is "message".
+	Event string
+
+	// Data is the payload, multi-line data is sent as multiple data fields.
+	// The CRLF, CR and LF are all line terminators.
+	Data string
+
+	// Retry is the reconnection time hint.
+	Retry time.Duration
+}
+
+// Options configures the Stream.
+type Options struct {
+	// Heartbeat is the interval of the comment lines sent to keep the
+	// connection alive through proxies, zero disables it.
+	Heartbeat time.Duration
+
+	// Retry is the reconnection time hint sent when the stream starts.
+	Retry time.Duration
+}
+
+// Stream writes events to the client.
+type Stream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+	cancel  context.CancelFunc
+	lastID  string
+	err     error
+}
+
+// New starts the stream by writing the response header. The stream is
+// closed when the request context is done or Close is called.
+//
+// The stream can not be used with httpmux.WithTimeout, because the timeout
+// buffers the response.
+func New(w http.ResponseWriter, r *http.Request, opts Options) (*Stream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	s := Stream{
+		w:       w,
+		flusher: flusher,
+		ctx:     ctx,
+		cancel:  cancel,
+		lastID:  r.Header.Get("Last-Event-ID"),
+	}
+
+	if opts.Retry > 0 {
+		s.write("retry: " + strconv.FormatInt(opts.Retry.Milliseconds(), 10) + "\n\n")
+	} else {
+		flusher.Flush()
+	}
+
+	if opts.Heartbeat > 0 {
+		go s.heartbeat(opts.Heartbeat)
+	}
+
+	return &s, nil
+}
+
+// LastEventID returns the ID sent by a reconnecting client, the handler
+// should resume the stream after this ID.
+func (s *Stream) LastEventID() string {
+	return s.lastID
+}
+
+// Done is closed when the client disconnects or the stream is closed.
+func (s *Stream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send writes the event and flushes it to the client.
+func (s *Stream) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n") || strings.ContainsAny(e.Event, "\r\n") {
+		return ErrInvalidField
+	}
+
+	var sb strings.Builder
+	if e.ID != "" {
+		sb.WriteString("id: " + e.ID + "\n")
+	}
+
+	if e.Event != "" {
+		sb.WriteString("event: " + e.Event + "\n")
+	}
+
+	if e.Retry > 0 {
+		sb.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	data := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(e.Data)
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+
+	sb.WriteString("\n")
+	return s.write(sb.String())
+}
+
+// Close stops the stream and waits for the in-flight write. It doesn't close
+// the connection, the handler must call Close before it returns.
+func (s *Stream) Close() {
+	s.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+}
+
+func (s *Stream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return err
+	}
+
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		s.err = err
+		s.cancel()
+		return err
+	}
+
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *Stream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
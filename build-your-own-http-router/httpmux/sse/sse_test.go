@@ -0,0 +1,162 @@
+package sse
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+func newTestServer(t *testing.T, opts Options, done chan<- struct{}) *httptest.Server {
+	router := httpmux.NewRouter()
+	router.HandleFunc(http.MethodGet, "/v1/jobs/{jid}/events", func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+
+		stream, err := New(w, r, opts)
+		if err != nil {
+			t.Errorf("expecting error nil but got %v", err)
+			return
+		}
+		defer stream.Close()
+
+		// resumes after the last event ID.
+		start := 1
+		if id, err := strconv.Atoi(stream.LastEventID()); err == nil {
+			start = id + 1
+		}
+
+		jid := httpmux.GetVars(r.Context()).ByName("jid")
+		for i := start; i <= 3; i++ {
+			err := stream.Send(Event{
+				ID:    strconv.Itoa(i),
+				Event: "progress",
+				Data:  "job " + jid + "\n" + strconv.Itoa(i) + "/3",
+			})
+			if err != nil {
+				return
+			}
+		}
+
+		<-stream.Done()
+	})
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func readBlocks(t *testing.T, r *bufio.Reader, n int) []string {
+	t.Helper()
+
+	var blocks []string
+	var sb strings.Builder
+	for len(blocks) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expecting error nil but got %v", err)
+		}
+
+		if line == "\n" {
+			blocks = append(blocks, sb.String())
+			sb.Reset()
+			continue
+		}
+
+		sb.WriteString(line)
+	}
+
+	return blocks
+}
+
+func TestStream(t *testing.T) {
+	done := make(chan struct{})
+	srv := newTestServer(t, Options{Retry: 3 * time.Second}, done)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/jobs/7/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("expecting content type text/event-stream but got %q", got)
+	}
+
+	blocks := readBlocks(t, bufio.NewReader(res.Body), 3)
+	exp := []string{
+		"retry: 3000\n",
+		"id: 2\nevent: progress\ndata: job 7\ndata: 2/3\n",
+		"id: 3\nevent: progress\ndata: job 7\ndata: 3/3\n",
+	}
+
+	for i := range exp {
+		if blocks[i] != exp[i] {
+			t.Errorf("expecting block %q but got %q", exp[i], blocks[i])
+		}
+	}
+
+	// the handler must return when the client disconnects.
+	_ = res.Body.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expecting handler returns after client disconnects")
+	}
+}
+
+func TestStream_Heartbeat(t *testing.T) {
+	done := make(chan struct{})
+	srv := newTestServer(t, Options{Heartbeat: 10 * time.Millisecond}, done)
+
+	res, err := http.Get(srv.URL + "/v1/jobs/1/events")
+	if err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+	defer res.Body.Close()
+
+	blocks := readBlocks(t, bufio.NewReader(res.Body), 4)
+	if blocks[3] != ": heartbeat\n" {
+		t.Errorf("expecting heartbeat but got %q", blocks[3])
+	}
+}
+
+func TestNew_StreamingUnsupported(t *testing.T) {
+	var w struct{ http.ResponseWriter }
+	w.ResponseWriter = httptest.NewRecorder()
+
+	if _, err := New(w, httptest.NewRequest(http.MethodGet, "/", nil), Options{}); err != ErrStreamingUnsupported {
+		t.Errorf("expecting %v but got %v", ErrStreamingUnsupported, err)
+	}
+}
+
+func TestStream_LineTerminators(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s, err := New(rec, httptest.NewRequest(http.MethodGet, "/events", nil), Options{})
+	if err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Send(Event{Data: "a\rid: 666\r\nb\nevent: admin"}); err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+
+	exp := "data: a\ndata: id: 666\ndata: b\ndata: event: admin\n\n"
+	if got := rec.Body.String(); got != exp {
+		t.Errorf("expecting %q but got %q", exp, got)
+	}
+
+	for _, e := range []Event{{ID: "1\rretry: 1"}, {Event: "x\nid: 2"}} {
+		if err := s.Send(e); !errors.Is(err, ErrInvalidField) {
+			t.Errorf("expecting ErrInvalidField for %+v but got %v", e, err)
+		}
+	}
+}
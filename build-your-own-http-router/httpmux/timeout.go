@@ -0,0 +1,160 @@
+package httpmux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const timeoutDetail = "the handler did not respond in time"
+
+// timeoutHandler runs the handler with a context deadline. It is similar to
+// http.TimeoutHandler, but the timeout response is written by the router.
+func timeoutHandler(handler http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		r = r.WithContext(ctx)
+
+		done := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
+		tw := &timeoutWriter{
+			header: make(http.Header),
+			status: http.StatusOK,
+		}
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicChan <- p
+				}
+			}()
+
+			handler.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			dst := w.Header()
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+
+			w.WriteHeader(tw.status)
+			_, _ = w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			tw.timedOut = true
+			writeError(w, r, http.StatusServiceUnavailable, timeoutDetail)
+		}
+	})
+}
+
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	tw.wroteHeader = true
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+
+	tw.wroteHeader = true
+	tw.status = code
+}
+
+// maxBodySizeHandler limits the request body using http.MaxBytesReader.
+func maxBodySizeHandler(handler http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			writeError(w, r, http.StatusRequestEntityTooLarge, bodyLimitDetail(n))
+			return
+		}
+
+		if r.Body == nil {
+			r.Body = http.NoBody
+		}
+
+		body := &maxBytesBody{
+			ReadCloser: http.MaxBytesReader(w, r.Body, n),
+			limit:      n,
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.Body = body
+
+		rw := newResponseWriter(w)
+		handler.ServeHTTP(rw, r2)
+
+		// the handler may ignore the read error, so makes sure the client
+		// gets the consistent response.
+		if body.exceeded.Load() && !rw.wroteHeader {
+			writeError(w, r, http.StatusRequestEntityTooLarge, body.detail())
+		}
+	})
+}
+
+type maxBytesBody struct {
+	io.ReadCloser
+	limit    int64
+	exceeded atomic.Bool
+}
+
+func (b *maxBytesBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		b.exceeded.Store(true)
+	}
+
+	return n, err
+}
+
+func (b *maxBytesBody) detail() string {
+	return bodyLimitDetail(b.limit)
+}
+
+func bodyLimitDetail(n int64) string {
+	return "the request body exceeds the limit of " + strconv.FormatInt(n, 10) + " bytes"
+}
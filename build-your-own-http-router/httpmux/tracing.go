@@ -0,0 +1,231 @@
+package httpmux
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpanKind is the role of the span in the trace.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+// SpanStatus is the status of the span, it matches the OpenTelemetry
+// status codes.
+type SpanStatus int
+
+const (
+	SpanStatusUnset SpanStatus = iota
+	SpanStatusError
+	SpanStatusOK
+)
+
+// Attribute is a key-value pair describing the span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is the unit of work traced by the Tracer. It is a subset of the
+// OpenTelemetry trace.Span, so the OpenTelemetry SDK can be adapted without
+// making the package depends on it.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	SetStatus(status SpanStatus, description string)
+	End()
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span)
+}
+
+// Tracing creates a middleware that starts a server span for each request.
+// The span is named after the matched route, e.g. "GET /v1/users/{uid}",
+// and has the OpenTelemetry HTTP semantic attributes. When the tracer
+// stores the TraceContext of the span in the context, like the
+// InMemoryExporter does, it is written on the response traceparent header.
+func Tracing(tracer Tracer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := r.Method
+			attrs := requestAttributes(r)
+			if route := GetRoute(r.Context()); route != nil {
+				name = route.Method + " " + route.Pattern
+				attrs = append(attrs, Attribute{Key: "http.route", Value: route.Pattern})
+			}
+
+			ctx, span := tracer.Start(r.Context(), name, SpanKindServer, attrs...)
+			defer span.End()
+
+			if tc, ok := GetTraceContext(ctx); ok && tc.SpanID != [8]byte{} {
+				tc.Inject(w.Header())
+			}
+
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			span.SetAttributes(Attribute{Key: "http.response.status_code", Value: rw.status})
+			if rw.status >= http.StatusInternalServerError {
+				span.SetStatus(SpanStatusError, http.StatusText(rw.status))
+			}
+		})
+	}
+}
+
+func requestAttributes(r *http.Request) []Attribute {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	attrs := []Attribute{
+		{Key: "http.request.method", Value: r.Method},
+		{Key: "url.path", Value: r.URL.Path},
+		{Key: "url.scheme", Value: scheme},
+		{Key: "network.protocol.version", Value: strconv.Itoa(r.ProtoMajor) + "." + strconv.Itoa(r.ProtoMinor)},
+	}
+
+	if r.URL.RawQuery != "" {
+		attrs = append(attrs, Attribute{Key: "url.query", Value: r.URL.RawQuery})
+	}
+
+	if host, port, err := net.SplitHostPort(r.Host); err == nil {
+		attrs = append(attrs, Attribute{Key: "server.address", Value: host})
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, Attribute{Key: "server.port", Value: p})
+		}
+	} else if r.Host != "" {
+		attrs = append(attrs, Attribute{Key: "server.address", Value: r.Host})
+	}
+
+	if ua := r.UserAgent(); ua != "" {
+		attrs = append(attrs, Attribute{Key: "user_agent.original", Value: ua})
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		attrs = append(attrs, Attribute{Key: "client.address", Value: host})
+	}
+
+	return attrs
+}
+
+// RecordedSpan is a span recorded by the InMemoryExporter.
+type RecordedSpan struct {
+	Name              string
+	Kind              SpanKind
+	TraceContext      TraceContext
+	Attributes        map[string]interface{}
+	Status            SpanStatus
+	StatusDescription string
+	StartTime         time.Time
+	EndTime           time.Time
+}
+
+// InMemoryExporter is a Tracer that keeps the ended spans in memory, it is
+// meant for tests. The spans continue the TraceContext found in the context:
+// the parent of a span is the span of the context, or the upstream parent-id
+// when the context comes from the TraceContextPropagation middleware.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span) {
+	tc, ok := GetTraceContext(ctx)
+	switch {
+	case !ok:
+		tc = NewTraceContext()
+	case tc.SpanID == [8]byte{}:
+		// the context comes from the propagation, no span is started yet, so
+		// the parent is the upstream parent-id kept in the ParentSpanID.
+		_, _ = rand.Read(tc.SpanID[:])
+	default:
+		tc.ParentSpanID = tc.SpanID
+		_, _ = rand.Read(tc.SpanID[:])
+	}
+
+	span := inMemorySpan{
+		exporter: e,
+		data: RecordedSpan{
+			Name:         name,
+			Kind:         kind,
+			TraceContext: tc,
+			Attributes:   make(map[string]interface{}),
+			StartTime:    time.Now(),
+		},
+	}
+
+	span.SetAttributes(attrs...)
+	return ContextWithTraceContext(ctx, tc), &span
+}
+
+// Spans returns the ended spans in the order they ended.
+func (e *InMemoryExporter) Spans() []RecordedSpan {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]RecordedSpan(nil), e.spans...)
+}
+
+// Reset removes the recorded spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = nil
+}
+
+type inMemorySpan struct {
+	mu       sync.Mutex
+	exporter *InMemoryExporter
+	data     RecordedSpan
+	ended    bool
+}
+
+func (s *inMemorySpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *inMemorySpan) SetStatus(status SpanStatus, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Status = status
+	s.data.StatusDescription = description
+}
+
+func (s *inMemorySpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+
+	s.ended = true
+	s.data.EndTime = time.Now()
+
+	s.exporter.mu.Lock()
+	defer s.exporter.mu.Unlock()
+
+	s.exporter.spans = append(s.exporter.spans, s.data)
+}
@@ -0,0 +1,72 @@
+package httpmux
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := NewInMemoryExporter()
+
+	router := NewRouter()
+	router.Use(TraceContextPropagation(), Tracing(exporter))
+	router.HandleFunc(http.MethodGet, "/v1/users/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := exporter.Start(r.Context(), "load user", SpanKindInternal)
+		span.End()
+	})
+	router.HandleFunc(http.MethodPost, "/v1/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/v1/users/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("User-Agent", "test")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expecting 2 spans but got %d", len(spans))
+	}
+
+	child, server := spans[0], spans[1]
+	ExpectTrue(t, server.Name == "GET /v1/users/{uid}")
+	ExpectTrue(t, server.Kind == SpanKindServer)
+	ExpectTrue(t, server.Status == SpanStatusUnset)
+	ExpectTrue(t, server.TraceContext.TraceIDString() == "4bf92f3577b34da6a3ce929d0e0e4736")
+	ExpectTrue(t, hex.EncodeToString(server.TraceContext.ParentSpanID[:]) == "00f067aa0ba902b7")
+	ExpectTrue(t, server.TraceContext.SpanID != server.TraceContext.ParentSpanID)
+	ExpectTrue(t, child.TraceContext.TraceID == server.TraceContext.TraceID)
+	ExpectTrue(t, child.TraceContext.ParentSpanID == server.TraceContext.SpanID)
+	ExpectHeader(t, rec.Header(), "traceparent", server.TraceContext.TraceParent())
+
+	expAttrs := map[string]interface{}{
+		"http.request.method":       "GET",
+		"http.route":                "/v1/users/{uid}",
+		"http.response.status_code": 200,
+		"url.path":                  "/v1/users/1",
+		"url.scheme":                "http",
+		"server.address":            "example.com",
+		"server.port":               8080,
+		"user_agent.original":       "test",
+		"client.address":            "192.0.2.1",
+		"network.protocol.version":  "1.1",
+	}
+
+	for key, value := range expAttrs {
+		if server.Attributes[key] != value {
+			t.Errorf("expecting attribute %s is %v but got %v", key, value, server.Attributes[key])
+		}
+	}
+
+	exporter.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/users", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	spans = exporter.Spans()
+	ExpectTrue(t, len(spans) == 2)
+	ExpectTrue(t, spans[0].Name == "POST /v1/users" && spans[0].Status == SpanStatusError)
+	ExpectTrue(t, spans[1].Name == "GET" && spans[1].Attributes["http.response.status_code"] == 404)
+}
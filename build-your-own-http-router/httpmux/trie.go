@@ -4,10 +4,14 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 )
 
-var varsNameRegex = regexp.MustCompile("^\\{[a-zA-z]+\\}$")
+var (
+	varsNameRegex     = regexp.MustCompile("^\\{[a-zA-Z_][a-zA-Z0-9_]*\\}$")
+	catchAllNameRegex = regexp.MustCompile("^\\{([a-zA-Z_][a-zA-Z0-9_]*)?\\.\\.\\.\\}$")
+)
 
 type NodeKind string
 
@@ -29,16 +33,22 @@ func (v Vars) ByName(name string) string {
 }
 
 const (
-	RootNode = NodeKind("root")
-	VarsNode = NodeKind("vars")
-	PathNode = NodeKind("path")
+	RootNode     = NodeKind("root")
+	VarsNode     = NodeKind("vars")
+	PathNode     = NodeKind("path")
+	CatchAllNode = NodeKind("catch-all")
 )
 
 const (
-	RootLabel = "__ROOT__"
-	VarsLabel = "__VARS__"
+	RootLabel     = "__ROOT__"
+	VarsLabel     = "__VARS__"
+	CatchAllLabel = "__CATCHALL__"
 )
 
+// MethodAny registers a handler for every method that has no handler of its
+// own on the same node.
+const MethodAny = "*"
+
 type TrieNode struct {
 	Label    string
 	Kind     NodeKind
@@ -57,6 +67,28 @@ func NewTrieNode(kind NodeKind, label string) *TrieNode {
 	return &node
 }
 
+// Methods returns the sorted list of methods registered on the node.
+func (n *TrieNode) Methods() []string {
+	methods := make([]string, 0, len(n.Value))
+	for method := range n.Value {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+	return methods
+}
+
+// Handler returns the handler registered for the method, falling back to the
+// MethodAny handler.
+func (n *TrieNode) Handler(method string) (http.Handler, bool) {
+	if handler, ok := n.Value[method]; ok {
+		return handler, true
+	}
+
+	handler, ok := n.Value[MethodAny]
+	return handler, ok
+}
+
 type Trie struct {
 	root *TrieNode
 }
@@ -80,7 +112,12 @@ func (t *Trie) Insert(path string, method string, handler http.Handler) error {
 
 	visitedNode := t.root
 
-	for _, segment := range segments {
+	for i, segment := range segments {
+		// the vars and catch-all nodes are stored under the reserved labels.
+		if segment == VarsLabel || segment == CatchAllLabel {
+			return errors.New("reserved segment")
+		}
+
 		nextNode, hasSegment := visitedNode.Children[segment]
 		if hasSegment {
 			visitedNode = nextNode
@@ -104,6 +141,27 @@ func (t *Trie) Insert(path string, method string, handler http.Handler) error {
 			continue
 		}
 
+		if catchAllNameRegex.MatchString(segment) {
+			if i != len(segments)-1 {
+				return errors.New("catch-all must be the last segment")
+			}
+
+			segment = strings.TrimSuffix(segment, "...}")
+			segment = strings.TrimPrefix(segment, "{")
+
+			_, hasCatchAll := visitedNode.Children[CatchAllLabel]
+			if !hasCatchAll {
+				visitedNode.Children[CatchAllLabel] = NewTrieNode(CatchAllNode, segment)
+			}
+
+			visitedNode = visitedNode.Children[CatchAllLabel]
+			if visitedNode.Label != segment {
+				return errors.New("conflict location")
+			}
+
+			continue
+		}
+
 		visitedNode.Children[segment] = NewTrieNode(PathNode, segment)
 		visitedNode = visitedNode.Children[segment]
 	}
@@ -118,38 +176,182 @@ func (t *Trie) Insert(path string, method string, handler http.Handler) error {
 }
 
 func (t *Trie) Get(path string, method string) (http.Handler, Vars, error) {
+	node, vars, err := t.Lookup(path)
+	if err != nil {
+		return nil, vars, err
+	}
+
+	handler, hasMethodHandler := node.Handler(method)
+	if !hasMethodHandler {
+		return nil, vars, errors.New("handler not found")
+	}
+
+	return handler, vars, nil
+}
+
+// Lookup finds the node that matches the path regardless of the method.
+// The path segments are matched to the static children first, then to the
+// vars child, then to the catch-all child, and the lookup backtracks if a
+// branch doesn't lead to a node with handlers.
+func (t *Trie) Lookup(path string) (*TrieNode, Vars, error) {
+	return t.lookup(path, nil)
+}
+
+// LookupStep is a node visited by the Lookup, see Trie.Explain.
+type LookupStep struct {
+	// Depth is the index of the segment matched against the node.
+	Depth   int      `json:"depth"`
+	Segment string   `json:"segment"`
+	Label   string   `json:"label"`
+	Kind    NodeKind `json:"kind"`
+	Note    string   `json:"note"`
+}
+
+// Explain does the Lookup and returns the visited nodes in order, it tells
+// why the path matches a node or not.
+func (t *Trie) Explain(path string) ([]LookupStep, *TrieNode, Vars, error) {
+	tracer := &lookupTracer{}
+	node, vars, err := t.lookup(path, tracer)
+	return tracer.steps, node, vars, err
+}
+
+func (t *Trie) lookup(path string, tracer *lookupTracer) (*TrieNode, Vars, error) {
 	path = strings.TrimPrefix(path, "/")
 	path = strings.TrimSuffix(path, "/")
 
 	segments := strings.Split(path, "/")
+	if tracer != nil {
+		tracer.total = len(segments)
+	}
 
-	vars := make([]Var, 0)
-	visitedNode := t.root
+	node, vars, found := lookup(t.root, segments, make([]Var, 0), tracer)
+	if !found {
+		return nil, make([]Var, 0), errors.New("handler not found")
+	}
 
-	for _, segment := range segments {
-		childNode, hasSegment := visitedNode.Children[segment]
-		if !hasSegment {
-			// try to check vars
-			varsNode, hasVars := visitedNode.Children[VarsLabel]
-			if !hasVars {
-				return nil, vars, errors.New("handler not found")
+	return node, vars, nil
+}
+
+// lookupTracer records the LookupStep, the nil tracer records nothing.
+type lookupTracer struct {
+	total int
+	steps []LookupStep
+}
+
+func (lt *lookupTracer) trace(node *TrieNode, segments []string, note string) {
+	if lt == nil {
+		return
+	}
+
+	step := LookupStep{
+		Depth: lt.total - len(segments),
+		Label: node.Label,
+		Kind:  node.Kind,
+		Note:  note,
+	}
+
+	if len(segments) > 0 {
+		step.Segment = segments[0]
+	}
+
+	lt.steps = append(lt.steps, step)
+}
+
+func lookup(visitedNode *TrieNode, segments []string, vars Vars, tracer *lookupTracer) (*TrieNode, Vars, bool) {
+	if len(segments) == 0 {
+		if len(visitedNode.Value) > 0 {
+			tracer.trace(visitedNode, segments, "end of the path, the node has handlers")
+			return visitedNode, vars, true
+		}
+
+		tracer.trace(visitedNode, segments, "end of the path, the node has no handlers")
+
+		// a catch-all also matches an empty remainder.
+		return lookupCatchAll(visitedNode, segments, vars, tracer)
+	}
+
+	segment := segments[0]
+
+	// the segment equals to a reserved label must not match the vars or
+	// catch-all node as a static segment.
+	if segment != VarsLabel && segment != CatchAllLabel {
+		if childNode, hasSegment := visitedNode.Children[segment]; hasSegment {
+			tracer.trace(childNode, segments, "the static child matches the segment")
+			if node, matchedVars, found := lookup(childNode, segments[1:], vars, tracer); found {
+				return node, matchedVars, true
 			}
 
-			vars = append(vars, Var{
-				Name:  varsNode.Label,
-				Value: segment,
-			})
+			tracer.trace(childNode, segments, "backtrack, the static branch has no match")
+		}
+	}
+
+	// try to check vars
+	if varsNode, hasVars := visitedNode.Children[VarsLabel]; hasVars {
+		matchedVars := append(vars[:len(vars):len(vars)], Var{
+			Name:  varsNode.Label,
+			Value: segment,
+		})
+
+		tracer.trace(varsNode, segments, "the vars child captures the segment")
+		if node, matchedVars, found := lookup(varsNode, segments[1:], matchedVars, tracer); found {
+			return node, matchedVars, true
+		}
+
+		tracer.trace(varsNode, segments, "backtrack, the vars branch has no match")
+	}
 
-			visitedNode = varsNode
-		} else {
-			visitedNode = childNode
+	return lookupCatchAll(visitedNode, segments, vars, tracer)
+}
+
+func lookupCatchAll(visitedNode *TrieNode, segments []string, vars Vars, tracer *lookupTracer) (*TrieNode, Vars, bool) {
+	catchAllNode, hasCatchAll := visitedNode.Children[CatchAllLabel]
+	if !hasCatchAll {
+		if len(segments) > 0 {
+			tracer.trace(visitedNode, segments, "no child matches the segment")
 		}
+
+		return nil, vars, false
 	}
 
-	handler, hasMethodHandler := visitedNode.Value[method]
-	if !hasMethodHandler {
-		return nil, vars, errors.New("handler not found")
+	if len(catchAllNode.Value) == 0 {
+		tracer.trace(catchAllNode, segments, "the catch-all child has no handlers")
+		return nil, vars, false
 	}
 
-	return handler, vars, nil
+	tracer.trace(catchAllNode, segments, "the catch-all child captures the rest of the path")
+
+	// the anonymous catch-all doesn't capture the remainder.
+	if catchAllNode.Label != "" {
+		vars = append(vars, Var{
+			Name:  catchAllNode.Label,
+			Value: strings.Join(segments, "/"),
+		})
+	}
+
+	return catchAllNode, vars, true
+}
+
+// Walk visits the nodes in depth-first order, the children are visited in
+// the order of their labels.
+func (t *Trie) Walk(visit func(node *TrieNode)) {
+	walk(t.root, visit)
+}
+
+func walk(node *TrieNode, visit func(node *TrieNode)) {
+	visit(node)
+
+	for _, label := range childLabels(node) {
+		walk(node.Children[label], visit)
+	}
+}
+
+// childLabels returns the labels of the children in order.
+func childLabels(node *TrieNode) []string {
+	labels := make([]string, 0, len(node.Children))
+	for label := range node.Children {
+		labels = append(labels, label)
+	}
+
+	sort.Strings(labels)
+	return labels
 }
@@ -0,0 +1,367 @@
+package httpmux
+
+import (
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// patternHandler is a handler that knows its pattern, so the tests can tell
+// which route is matched.
+type patternHandler string
+
+func (patternHandler) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+func splitTestPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	path = strings.TrimSuffix(path, "/")
+	return strings.Split(path, "/")
+}
+
+func isVarSegment(segment string) bool {
+	return varsNameRegex.MatchString(segment)
+}
+
+func isCatchAllSegment(segment string) bool {
+	return catchAllNameRegex.MatchString(segment)
+}
+
+func varName(segment string) string {
+	segment = strings.TrimSuffix(segment, "...}")
+	return strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+}
+
+// segmentRank orders the segment kinds from the most specific, the missing
+// segment means the pattern ends there.
+func segmentRank(pattern []string, i int) int {
+	switch {
+	case i >= len(pattern):
+		return -1
+	case isCatchAllSegment(pattern[i]):
+		return 2
+	case isVarSegment(pattern[i]):
+		return 1
+	default:
+		return 0
+	}
+}
+
+type referenceRoute struct {
+	segments []string
+	methods  map[string]bool
+}
+
+func (r *referenceRoute) key() string {
+	return strings.Join(r.segments, "/")
+}
+
+// referenceMatcher is a brute-force matcher, it checks every route.
+type referenceMatcher struct {
+	routes []*referenceRoute
+}
+
+func (m *referenceMatcher) insert(pattern string, method string) bool {
+	segments := splitTestPath(pattern)
+	for i, segment := range segments {
+		if segment == VarsLabel || segment == CatchAllLabel {
+			return false
+		}
+
+		if isCatchAllSegment(segment) && i != len(segments)-1 {
+			return false
+		}
+	}
+
+	for _, route := range m.routes {
+		n := len(route.segments)
+		if len(segments) < n {
+			n = len(segments)
+		}
+
+		for i := 0; i < n; i++ {
+			a, b := route.segments[i], segments[i]
+			bothVars := isVarSegment(a) && isVarSegment(b)
+			bothCatchAll := isCatchAllSegment(a) && isCatchAllSegment(b)
+			if bothVars || bothCatchAll {
+				if varName(a) != varName(b) {
+					return false
+				}
+				continue
+			}
+
+			if a != b {
+				break
+			}
+		}
+	}
+
+	for _, route := range m.routes {
+		if reflect.DeepEqual(route.segments, segments) {
+			if route.methods[method] {
+				return false
+			}
+
+			route.methods[method] = true
+			return true
+		}
+	}
+
+	m.routes = append(m.routes, &referenceRoute{
+		segments: segments,
+		methods:  map[string]bool{method: true},
+	})
+
+	return true
+}
+
+// match returns the most specific route: at the first segment where the
+// matching routes differ, the static segment wins over the vars, and the vars
+// win over the catch-all.
+func (m *referenceMatcher) match(path string) (*referenceRoute, Vars) {
+	segments := splitTestPath(path)
+
+	var best *referenceRoute
+	for _, route := range m.routes {
+		if !matchSegments(route.segments, segments) {
+			continue
+		}
+
+		if best == nil || moreSpecific(route.segments, best.segments) {
+			best = route
+		}
+	}
+
+	vars := make(Vars, 0)
+	if best == nil {
+		return nil, vars
+	}
+
+	for i, segment := range best.segments {
+		if isVarSegment(segment) {
+			vars = append(vars, Var{Name: varName(segment), Value: segments[i]})
+		}
+
+		if isCatchAllSegment(segment) && varName(segment) != "" {
+			vars = append(vars, Var{Name: varName(segment), Value: strings.Join(segments[i:], "/")})
+		}
+	}
+
+	return best, vars
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	last := len(pattern) - 1
+	if isCatchAllSegment(pattern[last]) {
+		// the catch-all matches the remainder, including the empty one.
+		if len(segments) < last {
+			return false
+		}
+
+		pattern, segments = pattern[:last], segments[:last]
+	}
+
+	if len(pattern) != len(segments) {
+		return false
+	}
+
+	for i := range pattern {
+		if !isVarSegment(pattern[i]) && pattern[i] != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func moreSpecific(a []string, b []string) bool {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+
+	for i := 0; i < n; i++ {
+		if aRank, bRank := segmentRank(a, i), segmentRank(b, i); aRank != bRank {
+			return aRank < bRank
+		}
+	}
+
+	return false
+}
+
+func expectSameMatch(t *testing.T, trie *Trie, ref *referenceMatcher, path string, method string) {
+	t.Helper()
+
+	handler, vars, err := trie.Get(path, method)
+	route, expVars := ref.match(path)
+
+	if route == nil || !route.methods[method] {
+		if err == nil {
+			t.Fatalf("%s %s: expected no handler; got %v", method, path, handler)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("%s %s: expected %s; got error %v", method, path, route.key(), err)
+	}
+
+	if got := string(handler.(patternHandler)); got != route.key() {
+		t.Fatalf("%s %s: expected %s; got %s", method, path, route.key(), got)
+	}
+
+	if !reflect.DeepEqual(expVars, vars) {
+		t.Fatalf("%s %s: expected vars %+v; got %+v", method, path, expVars, vars)
+	}
+
+	placeholders := 0
+	for _, segment := range route.segments {
+		if isVarSegment(segment) || (isCatchAllSegment(segment) && varName(segment) != "") {
+			placeholders++
+		}
+	}
+
+	if len(vars) != placeholders {
+		t.Fatalf("%s %s: expected %d vars; got %d", method, path, placeholders, len(vars))
+	}
+}
+
+var (
+	testStatics = []string{"a", "b", "users", "1"}
+	testVars    = []string{"{x}", "{y}", "{id}"}
+	testRests   = []string{"{rest}", "{rest...}", "{path...}", "{...}"}
+	testMethods = []string{http.MethodGet, http.MethodPost}
+)
+
+func randomPattern(rnd *rand.Rand) string {
+	segments := make([]string, 1+rnd.Intn(4))
+	for i := range segments {
+		if rnd.Intn(3) == 0 {
+			segments[i] = testVars[rnd.Intn(len(testVars))]
+		} else {
+			segments[i] = testStatics[rnd.Intn(len(testStatics))]
+		}
+	}
+
+	if rnd.Intn(4) == 0 {
+		segments[len(segments)-1] = testRests[rnd.Intn(len(testRests))]
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+// randomPath generates a path that is likely to match the pattern.
+func randomPath(rnd *rand.Rand, pattern string) string {
+	segments := splitTestPath(pattern)
+	for i, segment := range segments {
+		if isVarSegment(segment) || rnd.Intn(8) == 0 {
+			segments[i] = testStatics[rnd.Intn(len(testStatics))]
+		}
+
+		if isCatchAllSegment(segment) {
+			segments = append(segments[:i], testStatics[:rnd.Intn(len(testStatics))]...)
+			break
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+func TestTrie_Property(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+
+		trie := NewTrie()
+		again := NewTrie()
+		ref := &referenceMatcher{}
+
+		var patterns []string
+		for i := 0; i < 1+rnd.Intn(20); i++ {
+			pattern := randomPattern(rnd)
+			method := testMethods[rnd.Intn(len(testMethods))]
+			handler := patternHandler(strings.Join(splitTestPath(pattern), "/"))
+
+			err := trie.Insert(pattern, method, handler)
+			if accepted := ref.insert(pattern, method); accepted != (err == nil) {
+				t.Fatalf("seed %d: insert %s %s: expected accepted %v; got error %v", seed, method, pattern, accepted, err)
+			}
+
+			// the same routes in the same order must give the same result.
+			if errAgain := again.Insert(pattern, method, handler); (errAgain == nil) != (err == nil) {
+				t.Fatalf("seed %d: insert %s %s is not deterministic", seed, method, pattern)
+			}
+
+			patterns = append(patterns, pattern)
+		}
+
+		for i := 0; i < 50; i++ {
+			var path string
+			if rnd.Intn(4) == 0 {
+				path = randomPattern(rnd)
+			} else {
+				path = randomPath(rnd, patterns[rnd.Intn(len(patterns))])
+			}
+
+			for _, method := range testMethods {
+				expectSameMatch(t, trie, ref, path, method)
+			}
+		}
+	}
+}
+
+func FuzzTrie_Get(f *testing.F) {
+	routes := []string{
+		"/v1/users",
+		"/v1/users/{uid}",
+		"/v1/users/{uid}/profiles",
+		"/v1/users/{uid}/profiles/{pid}",
+		"/v1/users/static/profiles/{pid}",
+		"/v1/users/static/settings",
+		"/{version}/health",
+	}
+
+	trie := NewTrie()
+	ref := &referenceMatcher{}
+	for _, pattern := range routes {
+		if err := trie.Insert(pattern, http.MethodGet, patternHandler(strings.Join(splitTestPath(pattern), "/"))); err != nil {
+			f.Fatalf("insert %s: %v", pattern, err)
+		}
+		ref.insert(pattern, http.MethodGet)
+	}
+
+	f.Add("/v1/users/1", http.MethodGet)
+	f.Add("/v1/users/static/profiles", http.MethodGet)
+	f.Add("/v1/users/static/profiles/1", http.MethodPost)
+	f.Add("/v2/health", http.MethodGet)
+	f.Add("/v1/users/"+VarsLabel, http.MethodGet)
+	f.Add("//", http.MethodGet)
+	f.Add("", "")
+
+	f.Fuzz(func(t *testing.T, path string, method string) {
+		expectSameMatch(t, trie, ref, path, method)
+	})
+}
+
+func FuzzTrie_Insert(f *testing.F) {
+	f.Add("/v1/users/{uid}", "/v1/users/{id}/profiles", "/v1/users/1/profiles")
+	f.Add("/v1/users/static", "/v1/users/{uid}", "/v1/users/static")
+	f.Add("/a/"+VarsLabel, "/a/{x}", "/a/b")
+	f.Add("/a/{rest...}", "/a/{x}/b", "/a/1/c/d")
+	f.Add("/{...}", "/a/{p...}/b", "/")
+
+	f.Fuzz(func(t *testing.T, first string, second string, path string) {
+		trie := NewTrie()
+		ref := &referenceMatcher{}
+
+		for i, pattern := range []string{first, second} {
+			handler := patternHandler(strings.Join(splitTestPath(pattern), "/"))
+			err := trie.Insert(pattern, http.MethodGet, handler)
+			if accepted := ref.insert(pattern, http.MethodGet); accepted != (err == nil) {
+				t.Fatalf("insert[%d] %q: expected accepted %v; got error %v", i, pattern, accepted, err)
+			}
+		}
+
+		expectSameMatch(t, trie, ref, path, http.MethodGet)
+	})
+}
@@ -117,7 +117,7 @@ func ExpectPathRegisteredWithVars(t *testing.T, trie *Trie, path string, method
 		t.Fatalf("expected error nil; got error: %v", err)
 	}
 
-	if !reflect.DeepEqual(expVars, vars) {
+	if !reflect.DeepEqual(Vars(expVars), vars) {
 		t.Fatalf("expected %+v; got %+v", expVars, vars)
 	}
 
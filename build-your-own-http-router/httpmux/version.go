@@ -0,0 +1,332 @@
+package httpmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var versionContextKey = &contextType{name: "version"}
+
+// GetVersion returns the API version selected for the request.
+func GetVersion(ctx context.Context) string {
+	version, _ := ctx.Value(versionContextKey).(string)
+	return version
+}
+
+// VersionStrategy extracts the requested version, it returns an empty string
+// if the request doesn't ask for a version.
+type VersionStrategy func(r *http.Request) string
+
+// VersionFromHeader reads the version from a custom header, e.g.
+// "API-Version: 2". The "v" prefix is optional.
+func VersionFromHeader(name string) VersionStrategy {
+	return func(r *http.Request) string {
+		return normalizeVersion(r.Header.Get(name))
+	}
+}
+
+// VersionFromAccept reads the version from a parameter of the Accept media
+// type, e.g. "Accept: application/json; version=2".
+func VersionFromAccept(param string) VersionStrategy {
+	return func(r *http.Request) string {
+		for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+			params := strings.Split(mediaRange, ";")
+			for _, p := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], param) {
+					return normalizeVersion(strings.Trim(kv[1], `"`))
+				}
+			}
+		}
+
+		return ""
+	}
+}
+
+func normalizeVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 1 && (v[0] == 'v' || v[0] == 'V') {
+		return v[1:]
+	}
+
+	return v
+}
+
+// VersionFallback is the policy when the request doesn't ask for a version.
+type VersionFallback int
+
+const (
+	// FallbackDefault uses VersionOptions.Default.
+	FallbackDefault VersionFallback = iota
+
+	// FallbackLatest uses the last registered version.
+	FallbackLatest
+
+	// FallbackReject responds 400 Bad Request.
+	FallbackReject
+)
+
+// VersionOptions configures the API versioning.
+type VersionOptions struct {
+	// Strategies extract the requested version, they are tried in order.
+	Strategies []VersionStrategy
+
+	// PathPrefix also registers the routes of every version under the prefix
+	// followed by the version name, e.g. "/v" registers "/v1/users". Like
+	// the shared route, a version without its own handler uses the handler
+	// of the nearest older version.
+	PathPrefix string
+
+	// Default is the version used by FallbackDefault.
+	Default string
+
+	// Fallback is the policy when no version is requested.
+	Fallback VersionFallback
+
+	// Header is the response header that tells the selected version,
+	// default is "API-Version".
+	Header string
+}
+
+// VersionOption configures a version.
+type VersionOption func(*apiVersion)
+
+// DeprecatedSince marks the version as deprecated, the responses get the
+// Deprecation header.
+func DeprecatedSince(at time.Time) VersionOption {
+	return func(v *apiVersion) {
+		v.deprecated = at
+	}
+}
+
+// SunsetAt tells the clients when the version will be removed using the
+// Sunset header defined by RFC 8594.
+func SunsetAt(at time.Time) VersionOption {
+	return func(v *apiVersion) {
+		v.sunset = at
+	}
+}
+
+// DeprecationLink points the clients to the migration guide.
+func DeprecationLink(url string) VersionOption {
+	return func(v *apiVersion) {
+		v.link = url
+	}
+}
+
+type apiVersion struct {
+	name       string
+	index      int
+	deprecated time.Time
+	sunset     time.Time
+	link       string
+}
+
+func (v *apiVersion) setHeaders(h http.Header, header string) {
+	h.Set(header, v.name)
+
+	if !v.deprecated.IsZero() {
+		h.Set("Deprecation", "@"+strconv.FormatInt(v.deprecated.Unix(), 10))
+	}
+
+	if !v.sunset.IsZero() {
+		h.Set("Sunset", v.sunset.UTC().Format(http.TimeFormat))
+	}
+
+	if v.link != "" {
+		h.Add("Link", "<"+v.link+`>; rel="deprecation"`)
+	}
+}
+
+// Versions registers the same routes for multiple API versions.
+type Versions struct {
+	router   *Router
+	opts     VersionOptions
+	versions []*apiVersion
+	byName   map[string]*apiVersion
+	routes   map[string]*versionedHandler
+
+	// ordered are the routes in the registration order, so the prefixed
+	// routes of a new version are registered in the same order.
+	ordered []*versionedHandler
+}
+
+// ErrVersionRouteOptions is returned by VersionGroup.Handle when the route
+// options are passed by a registration that is not the first one of the
+// route.
+var ErrVersionRouteOptions = errors.New("httpmux: the route options are set by the first registered version")
+
+// Versions creates a set of API versions on the router.
+func (r *Router) Versions(opts VersionOptions) *Versions {
+	if opts.Header == "" {
+		opts.Header = "API-Version"
+	}
+
+	return &Versions{
+		router: r,
+		opts:   opts,
+		byName: make(map[string]*apiVersion),
+		routes: make(map[string]*versionedHandler),
+	}
+}
+
+// Version registers a version, the versions must be registered from the
+// oldest to the latest.
+func (vs *Versions) Version(name string, opts ...VersionOption) *VersionGroup {
+	v, ok := vs.byName[name]
+	if !ok {
+		v = &apiVersion{name: name, index: len(vs.versions)}
+		vs.versions = append(vs.versions, v)
+		vs.byName[name] = v
+
+		for _, vh := range vs.ordered {
+			vs.handlePrefixed(vh, v)
+		}
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return &VersionGroup{versions: vs, version: v}
+}
+
+// VersionGroup registers the routes of a version.
+type VersionGroup struct {
+	versions *Versions
+	version  *apiVersion
+}
+
+// Handle registers the handler of the version. The route is shared by all
+// versions, a version without its own handler uses the handler of the
+// nearest older version. The opts apply to every version, so only the first
+// registration of the route may pass them: a later registration with opts is
+// rejected with ErrVersionRouteOptions and its handler is not registered.
+func (vg *VersionGroup) Handle(method string, path string, handler http.Handler, opts ...RouteOption) error {
+	vs := vg.versions
+	key := method + " " + path
+
+	vh, ok := vs.routes[key]
+	if ok && len(opts) > 0 {
+		return fmt.Errorf("%w: %s", ErrVersionRouteOptions, key)
+	}
+
+	if !ok {
+		vh = &versionedHandler{
+			versions: vs,
+			method:   method,
+			path:     path,
+			handlers: make(map[string]http.Handler),
+			opts:     opts,
+		}
+
+		vs.routes[key] = vh
+		vs.ordered = append(vs.ordered, vh)
+		vs.router.Handle(method, path, vh, opts...)
+		for _, v := range vs.versions {
+			vs.handlePrefixed(vh, v)
+		}
+	}
+
+	if _, ok := vh.handlers[vg.version.name]; ok {
+		panic("httpmux: version " + vg.version.name + " of " + key + " is already registered")
+	}
+
+	vh.handlers[vg.version.name] = handler
+	return nil
+}
+
+func (vg *VersionGroup) HandleFunc(method string, path string, handler http.HandlerFunc, opts ...RouteOption) error {
+	return vg.Handle(method, path, handler, opts...)
+}
+
+// handlePrefixed registers the route of the version under the PathPrefix.
+func (vs *Versions) handlePrefixed(vh *versionedHandler, v *apiVersion) {
+	if vs.opts.PathPrefix == "" {
+		return
+	}
+
+	prefixed := joinPath(vs.opts.PathPrefix+v.name, vh.path)
+	vs.router.Handle(vh.method, prefixed, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vh.serveVersion(w, r, v)
+	}), vh.opts...)
+}
+
+func (vs *Versions) withVersion(v *apiVersion, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v.setHeaders(w.Header(), vs.opts.Header)
+		ctx := context.WithValue(r.Context(), versionContextKey, v.name)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// selectVersion returns the requested version, or the fallback.
+func (vs *Versions) selectVersion(r *http.Request) (*apiVersion, *Problem) {
+	for _, strategy := range vs.opts.Strategies {
+		name := strategy(r)
+		if name == "" {
+			continue
+		}
+
+		v, ok := vs.byName[name]
+		if !ok {
+			return nil, NewProblem(http.StatusBadRequest, "the version "+name+" is not supported")
+		}
+
+		return v, nil
+	}
+
+	switch vs.opts.Fallback {
+	case FallbackLatest:
+		if len(vs.versions) > 0 {
+			return vs.versions[len(vs.versions)-1], nil
+		}
+	case FallbackDefault:
+		if v, ok := vs.byName[vs.opts.Default]; ok {
+			return v, nil
+		}
+	}
+
+	return nil, NewProblem(http.StatusBadRequest, "the version is required")
+}
+
+type versionedHandler struct {
+	versions *Versions
+	method   string
+	path     string
+	handlers map[string]http.Handler
+
+	// opts are the route options of the first registration, they are
+	// shared by the prefixed routes of every version.
+	opts []RouteOption
+}
+
+func (vh *versionedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vs := vh.versions
+	v, problem := vs.selectVersion(r)
+	if problem != nil {
+		WriteProblem(w, r, problem)
+		return
+	}
+
+	vh.serveVersion(w, r, v)
+}
+
+func (vh *versionedHandler) serveVersion(w http.ResponseWriter, r *http.Request, v *apiVersion) {
+	vs := vh.versions
+
+	// inherits the handler of the nearest older version.
+	for i := v.index; i >= 0; i-- {
+		if handler, ok := vh.handlers[vs.versions[i].name]; ok {
+			vs.withVersion(v, handler).ServeHTTP(w, r)
+			return
+		}
+	}
+
+	WriteProblem(w, r, NewProblem(http.StatusNotFound, "the route is not available in version "+v.name))
+}
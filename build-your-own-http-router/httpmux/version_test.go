@@ -0,0 +1,144 @@
+package httpmux
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersions(t *testing.T) {
+	deprecated := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	versionHandler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+" "+GetVersion(r.Context())+" "+GetVars(r.Context()).ByName("uid"))
+		}
+	}
+
+	router := NewRouter()
+	versions := router.Versions(VersionOptions{
+		Strategies: []VersionStrategy{VersionFromHeader("API-Version"), VersionFromAccept("version")},
+		PathPrefix: "/v",
+		Default:    "1",
+	})
+
+	v1 := versions.Version("1", DeprecatedSince(deprecated), SunsetAt(sunset), DeprecationLink("https://example.com/migrate"))
+	v1.HandleFunc(http.MethodGet, "/users/{uid}", versionHandler("users.v1"))
+	v1.HandleFunc(http.MethodGet, "/posts", versionHandler("posts.v1"))
+
+	v2 := versions.Version("2")
+	v2.HandleFunc(http.MethodGet, "/users/{uid}", versionHandler("users.v2"))
+	v2.HandleFunc(http.MethodGet, "/comments", versionHandler("comments.v2"))
+
+	// declared after the routes, it inherits all of them.
+	versions.Version("3")
+
+	tests := []struct {
+		desc   string
+		path   string
+		header http.Header
+		status int
+		body   string
+	}{
+		{desc: "path prefix", path: "/v2/users/1", status: http.StatusOK, body: "users.v2 2 1"},
+		{desc: "deprecated path prefix", path: "/v1/users/1", status: http.StatusOK, body: "users.v1 1 1"},
+		{desc: "header", path: "/users/1", header: http.Header{"Api-Version": {"v2"}}, status: http.StatusOK, body: "users.v2 2 1"},
+		{desc: "accept", path: "/users/1", header: http.Header{"Accept": {"application/json; version=2"}}, status: http.StatusOK, body: "users.v2 2 1"},
+		{desc: "default", path: "/users/1", status: http.StatusOK, body: "users.v1 1 1"},
+		{desc: "inherited", path: "/posts", header: http.Header{"Api-Version": {"2"}}, status: http.StatusOK, body: "posts.v1 2 "},
+		{desc: "inherited path prefix", path: "/v2/posts", status: http.StatusOK, body: "posts.v1 2 "},
+		{desc: "later version path prefix", path: "/v3/users/1", status: http.StatusOK, body: "users.v2 3 1"},
+		{desc: "not available path prefix", path: "/v1/comments", status: http.StatusNotFound},
+		{desc: "unknown version", path: "/users/1", header: http.Header{"Api-Version": {"4"}}, status: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d; got %d", tt.status, rec.Code)
+			}
+
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expected body %q; got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	ExpectHeader(t, rec.Header(), "API-Version", "1")
+	ExpectHeader(t, rec.Header(), "Deprecation", "@1640995200")
+	ExpectHeader(t, rec.Header(), "Sunset", "Sun, 01 Jan 2023 00:00:00 GMT")
+	ExpectHeader(t, rec.Header(), "Link", `<https://example.com/migrate>; rel="deprecation"`)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/users/1", nil))
+	ExpectHeader(t, rec.Header(), "API-Version", "2")
+	ExpectHeader(t, rec.Header(), "Deprecation", "")
+}
+
+func TestVersions_Fallback(t *testing.T) {
+	router := NewRouter()
+	latest := router.Versions(VersionOptions{Fallback: FallbackLatest})
+	latest.Version("1").HandleFunc(http.MethodGet, "/latest", func(w http.ResponseWriter, r *http.Request) {})
+	latest.Version("2")
+
+	reject := router.Versions(VersionOptions{Fallback: FallbackReject})
+	reject.Version("1").HandleFunc(http.MethodGet, "/reject", func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/latest", nil))
+	ExpectTrue(t, rec.Code == http.StatusOK)
+	ExpectHeader(t, rec.Header(), "API-Version", "2")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reject", nil))
+	ExpectTrue(t, rec.Code == http.StatusBadRequest)
+}
+
+func TestVersions_RouteOptions(t *testing.T) {
+	router := NewRouter()
+	versions := router.Versions(VersionOptions{PathPrefix: "/v", Default: "1"})
+
+	v1 := versions.Version("1")
+	v1.HandleFunc(http.MethodPost, "/users", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+	}, WithMaxBodySize(4))
+
+	v2 := versions.Version("2")
+	v2.HandleFunc(http.MethodPost, "/users", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+	})
+
+	// the options of the first registration apply to every version.
+	for _, path := range []string{"/users", "/v1/users", "/v2/users"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader("12345")))
+		ExpectTrue(t, rec.Code == http.StatusRequestEntityTooLarge)
+	}
+
+	v3 := versions.Version("3")
+	err := v3.HandleFunc(http.MethodPost, "/users", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "v3")
+	}, WithTimeout(time.Second))
+	ExpectTrue(t, errors.Is(err, ErrVersionRouteOptions))
+
+	// the rejected handler is not registered, v3 inherits the handler of v2.
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v3/users", strings.NewReader("1234")))
+	ExpectTrue(t, rec.Code == http.StatusOK && rec.Body.String() == "")
+}
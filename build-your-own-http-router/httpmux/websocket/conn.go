@@ -0,0 +1,432 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+// Opcode is the frame type.
+type Opcode byte
+
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xA
+)
+
+func (op Opcode) isControl() bool {
+	return op&0x8 != 0
+}
+
+// Close codes defined by RFC 6455 section 7.4.1.
+const (
+	CloseNormalClosure      = 1000
+	CloseGoingAway          = 1001
+	CloseProtocolError      = 1002
+	CloseUnsupportedData    = 1003
+	CloseNoStatusReceived   = 1005
+	CloseInvalidPayloadData = 1007
+	ClosePolicyViolation    = 1008
+	CloseMessageTooBig      = 1009
+	CloseInternalServerErr  = 1011
+)
+
+// maxControlPayload is the maximum payload of the control frames.
+const maxControlPayload = 125
+
+var ErrClosed = errors.New("websocket: connection closed")
+
+// CloseError is returned by the read methods when the peer sends a close
+// frame, or when the connection is closed because of a protocol violation.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Reason)
+}
+
+// Frame is a single WebSocket frame, the payload is already unmasked.
+type Frame struct {
+	Fin     bool
+	Opcode  Opcode
+	Payload []byte
+}
+
+// Conn is a WebSocket connection. A Conn supports one concurrent reader and
+// multiple concurrent writers.
+type Conn struct {
+	netConn     net.Conn
+	br          *bufio.Reader
+	isServer    bool
+	subprotocol string
+	readLimit   int64
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	// messageMu is held by a data message from its first frame to its last
+	// one, so the fragments of a message are not interleaved with another
+	// message. The control frames only take writeMu, they may be sent
+	// between the fragments.
+	messageMu sync.Mutex
+
+	// OnPing is called when a ping is received, after the pong is sent.
+	OnPing func(payload []byte)
+
+	// OnPong is called when a pong is received.
+	OnPong func(payload []byte)
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.netConn
+}
+
+// SetReadLimit sets the maximum message size in bytes.
+func (c *Conn) SetReadLimit(n int64) {
+	c.readLimit = n
+}
+
+// ReadFrame reads a single frame. It validates the frame, but it doesn't
+// handle the control frames, see ReadMessage.
+func (c *Conn) ReadFrame() (Frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	frame := Frame{
+		Fin:    header[0]&0x80 != 0,
+		Opcode: Opcode(header[0] & 0x0F),
+	}
+
+	if header[0]&0x70 != 0 {
+		return frame, c.protocolError(CloseProtocolError, "reserved bits are set")
+	}
+
+	switch frame.Opcode {
+	case OpContinuation, OpText, OpBinary, OpClose, OpPing, OpPong:
+	default:
+		return frame, c.protocolError(CloseProtocolError, "unknown opcode")
+	}
+
+	masked := header[1]&0x80 != 0
+	if masked != c.isServer {
+		// the client must mask, and the server must not.
+		return frame, c.protocolError(CloseProtocolError, "invalid masking")
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if frame.Opcode.isControl() && (length > maxControlPayload || !frame.Fin) {
+		return frame, c.protocolError(CloseProtocolError, "invalid control frame")
+	}
+
+	if length > uint64(c.readLimit) {
+		return frame, c.protocolError(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return frame, err
+		}
+	}
+
+	frame.Payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, frame.Payload); err != nil {
+		return frame, err
+	}
+
+	if masked {
+		maskBytes(mask, frame.Payload)
+	}
+
+	return frame, nil
+}
+
+// WriteFrame writes a single frame, the client frames are masked. The frame
+// is written as is, use WriteMessage or NextWriter to write a data message
+// that is not interleaved with the other messages.
+func (c *Conn) WriteFrame(frame Frame) error {
+	if frame.Opcode.isControl() && (len(frame.Payload) > maxControlPayload || !frame.Fin) {
+		return errors.New("websocket: invalid control frame")
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrClosed
+	}
+
+	if frame.Opcode == OpClose {
+		c.closeSent = true
+	}
+
+	buf := make([]byte, 0, 14+len(frame.Payload))
+
+	b0 := byte(frame.Opcode)
+	if frame.Fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var maskBit byte
+	if !c.isServer {
+		maskBit = 0x80
+	}
+
+	n := len(frame.Payload)
+	switch {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		buf = append(buf, maskBit|127)
+		buf = append(buf, ext[:]...)
+	}
+
+	if c.isServer {
+		buf = append(buf, frame.Payload...)
+	} else {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, frame.Payload...)
+		maskBytes(mask, buf[start:])
+	}
+
+	_, err := c.netConn.Write(buf)
+	return err
+}
+
+// ReadMessage reads a complete message, assembling the fragmented frames.
+// Ping frames are answered with pong, and a close frame is answered with
+// close and returned as *CloseError.
+func (c *Conn) ReadMessage() (Opcode, []byte, error) {
+	var (
+		opcode  Opcode
+		message []byte
+	)
+
+	for {
+		frame, err := c.ReadFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frame.Opcode {
+		case OpPing:
+			if err := c.WriteFrame(Frame{Fin: true, Opcode: OpPong, Payload: frame.Payload}); err != nil && err != ErrClosed {
+				return 0, nil, err
+			}
+
+			if c.OnPing != nil {
+				c.OnPing(frame.Payload)
+			}
+			continue
+		case OpPong:
+			if c.OnPong != nil {
+				c.OnPong(frame.Payload)
+			}
+			continue
+		case OpClose:
+			return 0, nil, c.handleClose(frame.Payload)
+		case OpContinuation:
+			if opcode == 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			if opcode != 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "expecting continuation frame")
+			}
+			opcode = frame.Opcode
+		}
+
+		if int64(len(message)+len(frame.Payload)) > c.readLimit {
+			return 0, nil, c.protocolError(CloseMessageTooBig, "message too big")
+		}
+
+		message = append(message, frame.Payload...)
+		if !frame.Fin {
+			continue
+		}
+
+		if opcode == OpText && !utf8.Valid(message) {
+			return 0, nil, c.protocolError(CloseInvalidPayloadData, "invalid utf-8 text")
+		}
+
+		return opcode, message, nil
+	}
+}
+
+// WriteMessage writes the message as a single frame. It waits for the
+// message of a NextWriter to be closed.
+func (c *Conn) WriteMessage(opcode Opcode, data []byte) error {
+	if !opcode.isControl() {
+		c.messageMu.Lock()
+		defer c.messageMu.Unlock()
+	}
+
+	return c.WriteFrame(Frame{Fin: true, Opcode: opcode, Payload: data})
+}
+
+// NextWriter returns a writer that sends each Write as a fragment of the
+// message, the message is finished by Close. The writer holds the message
+// lock until Close, so the other messages wait for it while the control
+// frames can still be sent; the writer must be closed.
+func (c *Conn) NextWriter(opcode Opcode) io.WriteCloser {
+	c.messageMu.Lock()
+	return &messageWriter{conn: c, opcode: opcode}
+}
+
+// Ping sends a ping frame.
+func (c *Conn) Ping(payload []byte) error {
+	return c.WriteFrame(Frame{Fin: true, Opcode: OpPing, Payload: payload})
+}
+
+// Close sends the close frame with the code and reason. The peer response is
+// read by ReadMessage, the handler closes the network connection when it
+// returns.
+func (c *Conn) Close(code int, reason string) error {
+	return c.WriteFrame(Frame{Fin: true, Opcode: OpClose, Payload: closePayload(code, reason)})
+}
+
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+
+	switch {
+	case len(payload) == 1:
+		return c.protocolError(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.protocolError(CloseProtocolError, "invalid close code")
+		}
+
+		if !utf8.ValidString(closeErr.Reason) {
+			return c.protocolError(CloseInvalidPayloadData, "invalid utf-8 close reason")
+		}
+	}
+
+	// echoes the close code, as required by the closing handshake.
+	echo := closeErr.Code
+	if echo == CloseNoStatusReceived {
+		echo = CloseNormalClosure
+	}
+
+	if err := c.Close(echo, ""); err != nil && err != ErrClosed {
+		return err
+	}
+
+	return closeErr
+}
+
+// protocolError closes the connection with the code.
+func (c *Conn) protocolError(code int, reason string) error {
+	_ = c.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code == 1004 || code == 1005 || code == 1006:
+		return false
+	default:
+		return code >= 1000 && code <= 1011
+	}
+}
+
+func closePayload(code int, reason string) []byte {
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], reason)
+	return payload
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+}
+
+type messageWriter struct {
+	conn    *Conn
+	opcode  Opcode
+	started bool
+	closed  bool
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	if err := w.conn.WriteFrame(Frame{Opcode: w.frameOpcode(), Payload: p}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+	defer w.conn.messageMu.Unlock()
+
+	return w.conn.WriteFrame(Frame{Fin: true, Opcode: w.frameOpcode()})
+}
+
+func (w *messageWriter) frameOpcode() Opcode {
+	if w.started {
+		return OpContinuation
+	}
+
+	w.started = true
+	return w.opcode
+}
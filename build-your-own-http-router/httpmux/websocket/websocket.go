@@ -0,0 +1,217 @@
+// Package websocket upgrades httpmux routes to WebSocket connections as
+// defined by RFC 6455, without external dependencies.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+// acceptGUID is the GUID used to compute the Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Upgrader performs the opening handshake.
+type Upgrader struct {
+	// CheckOrigin validates the Origin header, default only accepts the
+	// requests without Origin or from the same host.
+	CheckOrigin func(r *http.Request) bool
+
+	// Subprotocols are the supported subprotocols in the server preference
+	// order.
+	Subprotocols []string
+
+	// ReadLimit is the maximum message size in bytes, default is 1 MiB.
+	ReadLimit int64
+}
+
+// Upgrade performs the handshake and hijacks the connection. If the
+// handshake fails, the error response is already written.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, u.fail(w, r, http.StatusMethodNotAllowed, "the handshake must use GET")
+	}
+
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return nil, u.fail(w, r, http.StatusUpgradeRequired, "the request is not a websocket upgrade")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, u.fail(w, r, http.StatusUpgradeRequired, "the websocket version is not supported")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, u.fail(w, r, http.StatusBadRequest, "the Sec-WebSocket-Key is invalid")
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+
+	if !checkOrigin(r) {
+		return nil, u.fail(w, r, http.StatusForbidden, "the origin is not allowed")
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+
+	// the response controller finds the Hijacker behind the wrapped
+	// response writers of the middlewares.
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil, u.fail(w, r, http.StatusInternalServerError, "the response writer does not support hijacking")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the deadlines of the server, e.g. the WriteTimeout, would close the
+	// long-lived connection. The net/http server clears them on hijack, the
+	// other Hijacker implementations may not.
+	if err := netConn.SetDeadline(time.Time{}); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	sb.WriteString("Upgrade: websocket\r\n")
+	sb.WriteString("Connection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		sb.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	sb.WriteString("\r\n")
+
+	if _, err := netConn.Write([]byte(sb.String())); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	readLimit := u.ReadLimit
+	if readLimit <= 0 {
+		readLimit = 1 << 20
+	}
+
+	conn := newConn(netConn, brw.Reader, true)
+	conn.subprotocol = subprotocol
+	conn.readLimit = readLimit
+	return conn, nil
+}
+
+func (u *Upgrader) fail(w http.ResponseWriter, r *http.Request, status int, detail string) error {
+	httpmux.WriteProblem(w, r, httpmux.NewProblem(status, detail))
+	return &HandshakeError{Status: status, Reason: detail}
+}
+
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	requested := headerTokens(r.Header, "Sec-WebSocket-Protocol")
+	for _, supported := range u.Subprotocols {
+		for _, protocol := range requested {
+			if protocol == supported {
+				return protocol
+			}
+		}
+	}
+
+	return ""
+}
+
+// HandshakeError is returned when the opening handshake fails.
+type HandshakeError struct {
+	Status int
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket: handshake failed: " + e.Reason
+}
+
+// Handler is a WebSocket handler. The request still carries the httpmux
+// context, e.g. httpmux.GetVars(r.Context()).
+type Handler func(conn *Conn, r *http.Request)
+
+// Handle creates an http.Handler that upgrades the request and calls the
+// handler, the connection is closed when the handler returns. It can be
+// registered on the httpmux.Router like any other handler, so the route
+// middlewares are applied before the handshake.
+func Handle(upgrader *Upgrader, handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.netConn.Close()
+
+		handler(conn, r)
+	})
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, value := range h.Values(name) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	return tokens
+}
+
+func headerContainsToken(h http.Header, name string, token string) bool {
+	for _, t := range headerTokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newConn is shared by the server and the client side, the reader may have
+// buffered bytes read after the handshake.
+func newConn(netConn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(netConn)
+	}
+
+	return &Conn{
+		netConn:   netConn,
+		br:        br,
+		isServer:  isServer,
+		readLimit: 1 << 20,
+	}
+}
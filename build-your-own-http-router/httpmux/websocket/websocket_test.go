@@ -0,0 +1,255 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	var calls []string
+	trace := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	upgrader := Upgrader{Subprotocols: []string{"chat.v2", "chat.v1"}}
+
+	router := httpmux.NewRouter()
+	router.Use(httpmux.Tracing(httpmux.NewInMemoryExporter()))
+	router.Handle(http.MethodGet, "/v1/rooms/{rid}", Handle(&upgrader, func(conn *Conn, r *http.Request) {
+		room := httpmux.GetVars(r.Context()).ByName("rid")
+		for {
+			opcode, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			reply := append([]byte(room+":"+conn.Subprotocol()+":"), msg...)
+			if err := conn.WriteMessage(opcode, reply); err != nil {
+				return
+			}
+		}
+	}), httpmux.WithMiddleware(trace))
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(func() {
+		srv.Close()
+		if len(calls) == 0 {
+			t.Errorf("expecting route middleware is called")
+		}
+	})
+
+	return srv
+}
+
+// dial performs the client side of the handshake.
+func dial(t *testing.T, srv *httptest.Server, path string, header http.Header) (*Conn, *http.Response) {
+	t.Helper()
+
+	netConn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+	t.Cleanup(func() { _ = netConn.Close() })
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if err := req.Write(netConn); err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+
+	br := bufio.NewReader(netConn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+
+	return newConn(netConn, br, false), res
+}
+
+func TestUpgrade(t *testing.T) {
+	srv := newTestServer(t)
+
+	conn, res := dial(t, srv, "/v1/rooms/42", http.Header{"Sec-Websocket-Protocol": {"chat.v1, chat.v2"}})
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expecting status 101 but got %d", res.StatusCode)
+	}
+
+	// the example of RFC 6455 section 1.3.
+	if got := res.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("expecting accept key s3pPLMBiTxaQ9kYGzzhZRbK+xOo= but got %q", got)
+	}
+
+	if got := res.Header.Get("Sec-WebSocket-Protocol"); got != "chat.v2" {
+		t.Errorf("expecting subprotocol chat.v2 but got %q", got)
+	}
+
+	t.Run("text message", func(t *testing.T) {
+		ExpectNoError(t, conn.WriteMessage(OpText, []byte("hello")))
+		opcode, msg, err := conn.ReadMessage()
+		ExpectNoError(t, err)
+		if opcode != OpText || string(msg) != "42:chat.v2:hello" {
+			t.Errorf("expecting text 42:chat.v2:hello but got %d %q", opcode, msg)
+		}
+	})
+
+	t.Run("fragmented binary message", func(t *testing.T) {
+		w := conn.NextWriter(OpBinary)
+		_, _ = w.Write([]byte{1, 2})
+		ExpectNoError(t, conn.Ping([]byte("in between")))
+		_, _ = w.Write(bytes.Repeat([]byte{3}, 70000))
+		ExpectNoError(t, w.Close())
+
+		var pong []byte
+		conn.OnPong = func(payload []byte) { pong = payload }
+
+		opcode, msg, err := conn.ReadMessage()
+		ExpectNoError(t, err)
+		if opcode != OpBinary || len(msg) != len("42:chat.v2:")+70002 {
+			t.Errorf("expecting binary message but got %d with %d bytes", opcode, len(msg))
+		}
+
+		if string(pong) != "in between" {
+			t.Errorf("expecting pong payload but got %q", pong)
+		}
+	})
+
+	t.Run("message waits for the fragmented message", func(t *testing.T) {
+		w := conn.NextWriter(OpBinary)
+		_, _ = w.Write([]byte("first "))
+
+		done := make(chan error, 1)
+		go func() { done <- conn.WriteMessage(OpText, []byte("second")) }()
+		time.Sleep(20 * time.Millisecond)
+
+		_, _ = w.Write([]byte("message"))
+		ExpectNoError(t, w.Close())
+		ExpectNoError(t, <-done)
+
+		for _, exp := range []string{"42:chat.v2:first message", "42:chat.v2:second"} {
+			_, msg, err := conn.ReadMessage()
+			ExpectNoError(t, err)
+			if string(msg) != exp {
+				t.Errorf("expecting message %q but got %q", exp, msg)
+			}
+		}
+	})
+
+	t.Run("closing handshake", func(t *testing.T) {
+		ExpectNoError(t, conn.Close(CloseGoingAway, "bye"))
+		_, _, err := conn.ReadMessage()
+
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway {
+			t.Errorf("expecting close 1001 but got %v", err)
+		}
+	})
+}
+
+func TestUpgrade_ServerTimeouts(t *testing.T) {
+	var upgrader Upgrader
+	srv := httptest.NewUnstartedServer(Handle(&upgrader, func(conn *Conn, r *http.Request) {
+		for {
+			opcode, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := conn.WriteMessage(opcode, msg); err != nil {
+				return
+			}
+		}
+	}))
+	srv.Config.ReadTimeout = 50 * time.Millisecond
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	conn, res := dial(t, srv, "/", nil)
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expecting status 101 but got %d", res.StatusCode)
+	}
+
+	// the connection outlives the deadlines of the server.
+	time.Sleep(100 * time.Millisecond)
+	ExpectNoError(t, conn.WriteMessage(OpText, []byte("still open")))
+	_, msg, err := conn.ReadMessage()
+	ExpectNoError(t, err)
+	if string(msg) != "still open" {
+		t.Errorf("expecting echo but got %q", msg)
+	}
+}
+
+func TestUpgrade_ProtocolError(t *testing.T) {
+	srv := newTestServer(t)
+	conn, _ := dial(t, srv, "/v1/rooms/1", nil)
+
+	// the client frames must be masked, so pretends to be the server.
+	conn.isServer = true
+	ExpectNoError(t, conn.WriteMessage(OpText, []byte("unmasked")))
+	conn.isServer = false
+
+	frame, err := conn.ReadFrame()
+	ExpectNoError(t, err)
+	if frame.Opcode != OpClose || !bytes.Equal(frame.Payload[:2], []byte{0x03, 0xEA}) {
+		t.Errorf("expecting close 1002 but got %d %v", frame.Opcode, frame.Payload)
+	}
+}
+
+func TestUpgrade_HandshakeError(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		desc   string
+		header http.Header
+		status int
+	}{
+		{desc: "bad version", header: http.Header{"Sec-Websocket-Version": {"8"}}, status: http.StatusUpgradeRequired},
+		{desc: "bad key", header: http.Header{"Sec-Websocket-Key": {"short"}}, status: http.StatusBadRequest},
+		{desc: "cross origin", header: http.Header{"Origin": {"https://evil.com"}}, status: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.desc, func(t *testing.T) {
+			_, res := dial(t, srv, "/v1/rooms/1", tt.header)
+			if res.StatusCode != tt.status {
+				t.Errorf("expecting status %d but got %d", tt.status, res.StatusCode)
+			}
+		})
+	}
+
+	res, err := http.Get(srv.URL + "/v1/rooms/1")
+	ExpectNoError(t, err)
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusUpgradeRequired || !strings.Contains(res.Header.Get("Content-Type"), "problem") {
+		t.Errorf("expecting problem 426 but got %d", res.StatusCode)
+	}
+}
+
+func ExpectNoError(t *testing.T, err error) {
+	if err != nil {
+		t.Helper()
+		t.Fatalf("expecting error nil but got %v", err)
+	}
+}
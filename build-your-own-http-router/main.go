@@ -1,10 +1,13 @@
 package main
 
 import (
-	"encoding/json"
-	"github.com/josestg/build-your-own-http-router/httpmux"
+	"context"
 	"log"
 	"net/http"
+	"time"
+
+	"github.com/josestg/build-your-own-http-router/httpmux"
+	"github.com/josestg/build-your-own-http-router/httpmux/render"
 )
 
 type Response struct {
@@ -17,18 +20,24 @@ type Response struct {
 func main() {
 	router := httpmux.NewRouter()
 
-	router.HandleFunc(http.MethodGet, "/v1/users", createHandler("get users"))
-	router.HandleFunc(http.MethodPost, "/v1/users", createHandler("create new user"))
-	router.HandleFunc(http.MethodGet, "/v1/users/{uid}", createHandler("get users detail"))
+	router.Handle(http.MethodGet, "/v1/users", createHandler("get users", http.StatusOK))
+	router.Handle(http.MethodPost, "/v1/users", createHandler("create new user", http.StatusCreated))
+	router.Handle(http.MethodGet, "/v1/users/{uid}", createHandler("get users detail", http.StatusOK))
+
+	srv := httpmux.NewServer(router, httpmux.ServerOptions{
+		Addr:            ":8080",
+		DrainDelay:      5 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+	})
 
-	if err := http.ListenAndServe(":8080", router); err != nil {
+	if err := srv.ListenAndServe(context.Background()); err != nil {
 		log.Fatalln(err)
 	}
 }
 
-func createHandler(name string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		_ = json.NewEncoder(w).Encode(&Response{
+func createHandler(name string, status int) httpmux.ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return render.Render(w, r, status, &Response{
 			Name:   name,
 			Method: r.Method,
 			Path:   r.URL.Path,